@@ -19,13 +19,14 @@ type Consumer struct {
 }
 
 type Metrics struct {
-	TotalGames      int64
-	TotalMoves      int64
-	TotalDuration   int64
-	WinnerCounts    map[string]int
-	GamesPerHour    map[string]int
-	BotGames        int64
-	PlayerGames     int64
+	TotalGames     int64
+	TotalMoves     int64
+	TotalThinkTime int64
+	TotalDuration  int64
+	WinnerCounts   map[string]int
+	GamesPerHour   map[string]int
+	BotGames       int64
+	PlayerGames    int64
 }
 
 type GameEvent struct {
@@ -42,9 +43,11 @@ type GameStartData struct {
 }
 
 type MoveData struct {
-	Player int `json:"player"`
-	Column int `json:"column"`
-	Row    int `json:"row"`
+	Player    int   `json:"player"`
+	Column    int   `json:"column"`
+	Row       int   `json:"row"`
+	Timestamp int64 `json:"timestamp"`
+	ThinkTime int64 `json:"think_time"`
 }
 
 type GameEndData struct {
@@ -110,6 +113,8 @@ func (c *Consumer) processMessage(data []byte) {
 		c.handleGameStart(event)
 	case "move":
 		c.handleMove(event)
+	case "takeback":
+		c.handleTakeback(event)
 	case "game_end":
 		c.handleGameEnd(event)
 	default:
@@ -146,9 +151,28 @@ func (c *Consumer) handleMove(event GameEvent) {
 
 	c.mu.Lock()
 	c.metrics.TotalMoves++
+	c.metrics.TotalThinkTime += data.ThinkTime
 	c.mu.Unlock()
 
-	log.Printf("[MOVE] Game %s - Player %d placed at column %d, row %d",
+	log.Printf("[MOVE] Game %s - Player %d placed at column %d, row %d after %dms",
+		event.GameID, data.Player, data.Column, data.Row, data.ThinkTime)
+}
+
+// handleTakeback discounts a move that was taken back, so that the move count
+// only covers moves that stayed on the board.
+func (c *Consumer) handleTakeback(event GameEvent) {
+	var data MoveData
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		log.Printf("Failed to unmarshal takeback data: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	c.metrics.TotalMoves--
+	c.metrics.TotalThinkTime -= data.ThinkTime
+	c.mu.Unlock()
+
+	log.Printf("[TAKEBACK] Game %s - Player %d took back column %d, row %d",
 		event.GameID, data.Player, data.Column, data.Row)
 }
 
@@ -222,13 +246,14 @@ func (c *Consumer) GetMetrics() *Metrics {
 	defer c.mu.Unlock()
 
 	metricsCopy := &Metrics{
-		TotalGames:    c.metrics.TotalGames,
-		TotalMoves:    c.metrics.TotalMoves,
-		TotalDuration: c.metrics.TotalDuration,
-		BotGames:      c.metrics.BotGames,
-		PlayerGames:   c.metrics.PlayerGames,
-		WinnerCounts:  make(map[string]int),
-		GamesPerHour:  make(map[string]int),
+		TotalGames:     c.metrics.TotalGames,
+		TotalMoves:     c.metrics.TotalMoves,
+		TotalThinkTime: c.metrics.TotalThinkTime,
+		TotalDuration:  c.metrics.TotalDuration,
+		BotGames:       c.metrics.BotGames,
+		PlayerGames:    c.metrics.PlayerGames,
+		WinnerCounts:   make(map[string]int),
+		GamesPerHour:   make(map[string]int),
 	}
 
 	for k, v := range c.metrics.WinnerCounts {
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"four-in-a-row/internal/game"
+	"four-in-a-row/internal/solver"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	moves []int
+	pos   *game.Position
+}
+
+type solved struct {
+	entry
+	score int
+}
+
+func main() {
+	variant := flag.String("variant", "classic", "board variant to generate the book for")
+	ply := flag.Int("ply", 8, "number of moves played in each book position")
+	timeout := flag.Duration("timeout", 0, "give up on a position after this long (0 means no limit)")
+	budget := flag.Duration("budget", 0, "stop solving new positions after this long (0 means no limit)")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of positions solved at once")
+	out := flag.String("out", "book.txt", "output file")
+	flag.Parse()
+
+	rules, ok := game.Variants[*variant]
+	if !ok {
+		log.Fatalf("unknown variant %q", *variant)
+	}
+	if rules.Columns > 9 {
+		log.Fatalf("opening books support at most 9 columns")
+	}
+
+	positions := collect(rules, *ply)
+	log.Printf("Solving %d positions at ply %d with %d workers", len(positions), *ply, *workers)
+
+	limit := *timeout
+	if limit == 0 {
+		limit = 365 * 24 * time.Hour
+	}
+	start := time.Now()
+	stop := start.Add(365 * 24 * time.Hour)
+	if *budget > 0 {
+		stop = start.Add(*budget)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", *out, err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	defer w.Flush()
+
+	if err := solver.WriteBookHeader(w, rules); err != nil {
+		log.Fatalf("Failed to write book: %v", err)
+	}
+
+	s := solver.New(rules)
+	jobs := make(chan entry)
+	results := make(chan solved)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				left := time.Until(stop)
+				if left <= 0 {
+					continue
+				}
+				score, err := s.Solve(e.pos, min(limit, left))
+				if err == nil {
+					results <- solved{entry: e, score: score}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for _, e := range positions {
+			jobs <- e
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	count, written := 0, 0
+	for r := range results {
+		// Mirrored positions have the same score, so each pair is solved
+		// once and written twice.
+		mirror := mirrored(r.moves, rules.Columns)
+		for _, moves := range [][]int{r.moves, mirror} {
+			if err := solver.WriteBookEntry(w, moves, r.score); err != nil {
+				log.Fatalf("Failed to write book: %v", err)
+			}
+			written++
+			if equal(r.moves, mirror) {
+				break
+			}
+		}
+
+		count++
+		if count%100 == 0 {
+			w.Flush()
+			log.Printf("Solved %d/%d positions in %v", count, len(positions), time.Since(start).Round(time.Second))
+		}
+	}
+
+	log.Printf("Wrote %d positions to %s (%d of %d solved) in %v", written, *out, count, len(positions), time.Since(start).Round(time.Second))
+}
+
+// collect returns the positions after ply moves that nobody has won, one of
+// each mirrored pair, with the most central openings first since those are
+// the ones played most.
+func collect(rules game.Rules, ply int) []entry {
+	seen := make(map[uint64]bool)
+	positions := make([]entry, 0)
+	pos := game.NewPosition(rules)
+	moves := make([]int, 0, ply)
+
+	var walk func()
+	walk = func() {
+		if pos.Moves() == ply {
+			if !seen[pos.Hash()] {
+				seen[pos.Hash()] = true
+				seen[replay(rules, mirrored(moves, rules.Columns)).Hash()] = true
+				recorded := make([]int, len(moves))
+				copy(recorded, moves)
+				positions = append(positions, entry{moves: recorded, pos: pos.Clone()})
+			}
+			return
+		}
+
+		for c := 0; c < rules.Columns; c++ {
+			if !pos.CanPlay(c) || pos.IsWinningMove(c) {
+				continue
+			}
+			pos.Play(c)
+			moves = append(moves, c)
+			walk()
+			moves = moves[:len(moves)-1]
+			pos.Undo(c)
+		}
+	}
+	walk()
+
+	center := rules.Columns / 2
+	distance := func(moves []int) int {
+		total := 0
+		for _, c := range moves {
+			total += abs(c - center)
+		}
+		return total
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return distance(positions[i].moves) < distance(positions[j].moves)
+	})
+
+	return positions
+}
+
+func replay(rules game.Rules, moves []int) *game.Position {
+	pos := game.NewPosition(rules)
+	for _, c := range moves {
+		pos.Play(c)
+	}
+	return pos
+}
+
+func mirrored(moves []int, columns int) []int {
+	mirror := make([]int, len(moves))
+	for i, c := range moves {
+		mirror[i] = columns - 1 - c
+	}
+	return mirror
+}
+
+func equal(a, b []int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
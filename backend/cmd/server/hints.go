@@ -0,0 +1,54 @@
+package main
+
+import (
+	"four-in-a-row/internal/bot"
+	ws "four-in-a-row/internal/websocket"
+	"time"
+)
+
+// HintThinkTime is how long the bot searches for a hint.
+const HintThinkTime = 300 * time.Millisecond
+
+// handleHint suggests a column to a player on their turn in a bot game. The
+// search runs without holding the game lock, and taking a hint makes the game
+// unrated.
+func (s *Server) handleHint(client *ws.Client) {
+	g, player := s.lockPlayerGame(client, false)
+	if g == nil {
+		return
+	}
+
+	message := ""
+	if !g.IsBot {
+		message = "Hints are only available in bot games"
+	} else if g.CurrentPlayer != player {
+		message = "Not your turn"
+	}
+	if message != "" {
+		g.Unlock()
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: message,
+		})
+		return
+	}
+
+	g.Hints++
+	hints := g.Hints
+	gameID := g.ID
+	pos := g.Position()
+	g.Unlock()
+
+	best := bot.Hint(pos, player, HintThinkTime)
+
+	s.Hub.SendToClient(client.ID, &ws.Message{
+		Type:   "hint",
+		GameID: gameID,
+		Player: player,
+		Hint: &ws.Hint{
+			Column: best.Column,
+			Score:  best.Score,
+			Hints:  hints,
+		},
+	})
+}
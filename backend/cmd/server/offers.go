@@ -0,0 +1,316 @@
+package main
+
+import (
+	"four-in-a-row/internal/bot"
+	"four-in-a-row/internal/game"
+	"four-in-a-row/internal/matchmaking"
+	ws "four-in-a-row/internal/websocket"
+	"log"
+	"time"
+)
+
+func (s *Server) handleResign(client *ws.Client) {
+	g, player := s.lockPlayerGame(client, false)
+	if g == nil {
+		return
+	}
+	defer g.Unlock()
+
+	g.Forfeit(player)
+	s.endGame(g, "resign")
+}
+
+func (s *Server) handleOfferDraw(client *ws.Client) {
+	g, player := s.lockPlayerGame(client, false)
+	if g == nil {
+		return
+	}
+	defer g.Unlock()
+
+	switch g.DrawOffer {
+	case player:
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: "Draw already offered",
+		})
+		return
+	case game.Opponent(player):
+		g.AgreeDraw()
+		s.endGame(g, "draw_agreed")
+		return
+	}
+
+	if g.IsBot {
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "draw_declined",
+			GameID:  g.ID,
+			Player:  g.BotPlayer,
+			Message: "The bot declined the draw",
+		})
+		return
+	}
+
+	g.DrawOffer = player
+	s.Hub.Broadcast <- &ws.Message{
+		Type:     "draw_offered",
+		GameID:   g.ID,
+		Player:   player,
+		Username: client.GetUsername(),
+	}
+}
+
+func (s *Server) handleAcceptDraw(client *ws.Client) {
+	g, player := s.lockPlayerGame(client, false)
+	if g == nil {
+		return
+	}
+	defer g.Unlock()
+
+	if g.DrawOffer != game.Opponent(player) {
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: "There is no draw offer to accept",
+		})
+		return
+	}
+
+	g.AgreeDraw()
+	s.endGame(g, "draw_agreed")
+}
+
+func (s *Server) handleDeclineDraw(client *ws.Client) {
+	g, player := s.lockPlayerGame(client, false)
+	if g == nil {
+		return
+	}
+	defer g.Unlock()
+
+	if g.DrawOffer != game.Opponent(player) {
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: "There is no draw offer to decline",
+		})
+		return
+	}
+
+	g.DrawOffer = 0
+	s.Hub.Broadcast <- &ws.Message{
+		Type:     "draw_declined",
+		GameID:   g.ID,
+		Player:   player,
+		Username: client.GetUsername(),
+	}
+}
+
+// handleTakebackRequest asks to take back the player's last move, along with
+// the opponent's reply if they have made one. The bot agrees at once.
+func (s *Server) handleTakebackRequest(client *ws.Client) {
+	g, player := s.lockPlayerGame(client, false)
+	if g == nil {
+		return
+	}
+	defer g.Unlock()
+
+	message := ""
+	if !g.Casual {
+		message = "Takebacks are only allowed in casual games"
+	} else if len(g.Line()) < takebackPlies(g, player) {
+		message = "You have no move to take back"
+	} else if g.TakebackOffer == player {
+		message = "Takeback already requested"
+	}
+	if message != "" {
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: message,
+		})
+		return
+	}
+
+	if g.IsBot {
+		s.takeBack(g, player)
+		return
+	}
+
+	g.TakebackOffer = player
+	s.Hub.Broadcast <- &ws.Message{
+		Type:     "takeback_requested",
+		GameID:   g.ID,
+		Player:   player,
+		Username: client.GetUsername(),
+	}
+}
+
+func (s *Server) handleTakebackAccept(client *ws.Client) {
+	g, player := s.lockPlayerGame(client, false)
+	if g == nil {
+		return
+	}
+	defer g.Unlock()
+
+	if g.TakebackOffer != game.Opponent(player) {
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: "There is no takeback request to accept",
+		})
+		return
+	}
+
+	s.takeBack(g, g.TakebackOffer)
+}
+
+// takebackPlies is how many moves have to be undone to take back player's
+// last move: just that move if it is the opponent's turn, or the opponent's
+// reply as well if it is player's turn again.
+func takebackPlies(g *game.Game, player int) int {
+	if g.CurrentPlayer == player {
+		return 2
+	}
+	return 1
+}
+
+// takeBack undoes player's last move, and the reply to it, leaving player to
+// move. It must be called with g locked.
+func (s *Server) takeBack(g *game.Game, player int) {
+	for i := takebackPlies(g, player); i > 0; i-- {
+		move, _ := g.UndoMove()
+		s.Kafka.SendTakeback(g.ID, move.Player, move.Column, move.Row, move.Timestamp, move.ThinkTime)
+	}
+
+	s.Hub.Broadcast <- &ws.Message{
+		Type:     "takeback",
+		GameID:   g.ID,
+		Player:   player,
+		Board:    g.BoardSnapshot(),
+		TimeLeft: g.ClockSnapshot(time.Now()),
+	}
+
+	log.Printf("Took back player %d's last move in game %s", player, g.ID)
+	s.watchClock(g)
+}
+
+func (s *Server) handleRematchRequest(client *ws.Client) {
+	g, player := s.lockFinishedGame(client)
+	if g == nil {
+		return
+	}
+	defer g.Unlock()
+
+	if g.IsBot {
+		opts := rematchOptions(g)
+		first := game.Player1
+		if opts.Start != nil {
+			first = opts.StartPlayer
+		}
+
+		opts.FirstPlayer = matchmaking.FirstPlayerBot
+		if g.BotPlayer == first {
+			opts.FirstPlayer = matchmaking.FirstPlayerMe
+		}
+
+		g.Rematched = true
+		s.MatchMaker.StartBotGame(client, opts)
+		return
+	}
+
+	switch g.RematchOffer {
+	case player:
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: "Rematch already requested",
+		})
+		return
+	case game.Opponent(player):
+		s.startRematch(g, client, player)
+		return
+	}
+
+	g.RematchOffer = player
+	s.Hub.Broadcast <- &ws.Message{
+		Type:     "rematch_requested",
+		GameID:   g.ID,
+		Player:   player,
+		Username: client.GetUsername(),
+	}
+}
+
+func (s *Server) handleRematchAccept(client *ws.Client) {
+	g, player := s.lockFinishedGame(client)
+	if g == nil {
+		return
+	}
+	defer g.Unlock()
+
+	if g.RematchOffer != game.Opponent(player) {
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: "There is no rematch request to accept",
+		})
+		return
+	}
+
+	s.startRematch(g, client, player)
+}
+
+// lockFinishedGame is lockPlayerGame for post-game messages: the game must be
+// over and not already followed by a rematch.
+func (s *Server) lockFinishedGame(client *ws.Client) (*game.Game, int) {
+	g, player := s.lockPlayerGame(client, true)
+	if g == nil {
+		return nil, 0
+	}
+
+	message := ""
+	if !g.IsOver {
+		message = "The game is still in progress"
+	} else if g.Rematched {
+		message = "A rematch has already started"
+	}
+
+	if message != "" {
+		g.Unlock()
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: message,
+		})
+		return nil, 0
+	}
+
+	return g, player
+}
+
+// startRematch starts a new game between the players of g with their colors
+// swapped. It must be called with g locked.
+func (s *Server) startRematch(g *game.Game, client *ws.Client, player int) {
+	opponent := s.seatClient(g, game.Opponent(player))
+	if opponent == nil {
+		s.Hub.SendToClient(client.ID, &ws.Message{
+			Type:    "error",
+			Message: "Your opponent is no longer available",
+		})
+		return
+	}
+
+	g.Rematched = true
+
+	var seats [2]*ws.Client
+	seats[player-1] = client
+	seats[game.Opponent(player)-1] = opponent
+
+	log.Printf("Rematch of game %s between %s and %s", g.ID, g.Player1Name, g.Player2Name)
+	s.MatchMaker.StartRematch(seats[1], seats[0], rematchOptions(g))
+}
+
+func rematchOptions(g *game.Game) matchmaking.Options {
+	opts := matchmaking.Options{
+		Rules:       g.Rules,
+		TimeControl: g.TimeControl,
+		Casual:      g.Casual,
+		Difficulty:  bot.Difficulty(g.Difficulty),
+	}
+	if g.Start != "" {
+		// Start was written by SetPosition, so it always parses.
+		opts.Start, opts.StartPlayer, _ = game.ParseBoard(g.Rules, g.Start)
+	}
+	return opts
+}
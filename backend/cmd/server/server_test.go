@@ -0,0 +1,302 @@
+package main
+
+import (
+	"four-in-a-row/internal/auth"
+	"four-in-a-row/internal/game"
+	"four-in-a-row/internal/solver"
+	ws "four-in-a-row/internal/websocket"
+	"four-in-a-row/pkg/kafka"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testClient is a websocket client that queues every message it receives.
+type testClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+	msgs chan ws.Message
+}
+
+func newTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	s := newServer(nil, kafka.NewProducer(nil, ""), solver.New(game.DefaultRules), auth.NewSigner([]byte("test"), auth.SessionTTL))
+	go s.MatchMaker.Run()
+	go s.Hub.Run()
+
+	srv := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	t.Cleanup(srv.Close)
+	return s, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *testClient {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	c := &testClient{t: t, conn: conn, msgs: make(chan ws.Message, 1024)}
+	go func() {
+		defer close(c.msgs)
+		for {
+			var msg ws.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+	return c
+}
+
+func (c *testClient) send(msg ws.Message) {
+	if err := c.conn.WriteJSON(msg); err != nil {
+		c.t.Errorf("send %s: %v", msg.Type, err)
+	}
+}
+
+// waitFor returns the next message of one of the given types, skipping any
+// others.
+func (c *testClient) waitFor(types ...string) ws.Message {
+	c.t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.msgs:
+			if !ok {
+				c.t.Fatalf("connection closed while waiting for %v", types)
+			}
+			for _, typ := range types {
+				if msg.Type == typ {
+					return msg
+				}
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for %v", types)
+		}
+	}
+}
+
+// collect returns the messages c receives until it has been quiet for a
+// while.
+func (c *testClient) collect() []ws.Message {
+	var msgs []ws.Message
+	for {
+		select {
+		case msg, ok := <-c.msgs:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		case <-time.After(500 * time.Millisecond):
+			return msgs
+		}
+	}
+}
+
+// spamMoves sends n moves in random columns, many of them out of turn.
+func spamMoves(c *testClient, seed int64, n int, pause time.Duration) {
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		c.send(ws.Message{Type: "move", Column: rng.Intn(game.DefaultRules.Columns)})
+		time.Sleep(time.Duration(rng.Int63n(int64(pause))))
+	}
+}
+
+// reconnect drops c and resumes its seat from a new connection. The reply is
+// an error if the game has ended in the meantime.
+func reconnect(t *testing.T, url string, c *testClient, start ws.Message, username string) (*testClient, ws.Message) {
+	c.conn.Close()
+	next := dial(t, url)
+	next.send(ws.Message{Type: "reconnect", GameID: start.GameID, Username: username, ReconnectToken: start.ReconnectToken})
+	return next, next.waitFor("game_reconnected", "error")
+}
+
+func TestConcurrentMovesAndReconnects(t *testing.T) {
+	s, url := newTestServer(t)
+
+	alice := dial(t, url)
+	bob := dial(t, url)
+	alice.send(ws.Message{Type: "join", Username: "alice"})
+	bob.send(ws.Message{Type: "join", Username: "bob"})
+	aliceStart := alice.waitFor("game_start")
+	bob.waitFor("game_start")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		spamMoves(bob, 4, 12, 20*time.Millisecond)
+	}()
+	spamMoves(alice, 2, 6, 20*time.Millisecond)
+	alice, resumed := reconnect(t, url, alice, aliceStart, "alice")
+	spamMoves(alice, 3, 6, 20*time.Millisecond)
+	wg.Wait()
+
+	// Every move that was accepted reached bob, in order, and the last one
+	// carries the board the server holds.
+	moves, ended := 0, false
+	var last ws.Message
+	for _, msg := range bob.collect() {
+		switch msg.Type {
+		case "move":
+			moves++
+			last = msg
+		case "game_end":
+			ended = true
+		}
+	}
+
+	g := s.Hub.GetGame(aliceStart.GameID)
+	g.Lock()
+	line := g.Line()
+	board := g.BoardSnapshot()
+	over := g.IsOver
+	g.Unlock()
+
+	if moves == 0 || moves != len(line) {
+		t.Fatalf("bob saw %d moves, the game has %d", moves, len(line))
+	}
+	if got, want := game.FormatBoard(last.Board, game.Player1), game.FormatBoard(board, game.Player1); got != want {
+		t.Errorf("last move showed %s, the game holds %s", got, want)
+	}
+	replayed, err := game.Replay(game.DefaultRules, "", line)
+	if err != nil {
+		t.Fatalf("the game's moves do not replay: %v", err)
+	}
+	if got := game.FormatBoard(replayed[len(line)], game.Player1); got != game.FormatBoard(board, game.Player1) {
+		t.Errorf("replaying the moves gives %s", got)
+	}
+	if over != ended {
+		t.Errorf("game over = %v, but bob saw game_end = %v", over, ended)
+	}
+	if resumed.Type == "error" && !over {
+		t.Errorf("reconnecting to a game in progress failed: %s", resumed.Message)
+	}
+
+	// Players stay mapped to the game until it ends.
+	want := aliceStart.GameID
+	if over {
+		want = ""
+	}
+	for _, name := range []string{"alice", "bob"} {
+		if id := s.Hub.GetPlayerGame(name); id != want {
+			t.Errorf("%s is mapped to game %q, want %q", name, id, want)
+		}
+	}
+
+	if !over {
+		bob.send(ws.Message{Type: "resign"})
+		bob.waitFor("game_end")
+	}
+}
+
+func TestConcurrentBotRepliesAndReconnects(t *testing.T) {
+	_, url := newTestServer(t)
+
+	carol := dial(t, url)
+	carol.send(ws.Message{Type: "play_bot", Username: "carol", Difficulty: "easy"})
+	start := carol.waitFor("game_start")
+
+	// Moves are paced so the bot replies while carol keeps playing and
+	// reconnecting.
+	var board game.Board
+	for i := int64(0); i < 3; i++ {
+		spamMoves(carol, i, 10, 100*time.Millisecond)
+		var resumed ws.Message
+		if carol, resumed = reconnect(t, url, carol, start, "carol"); resumed.Type == "error" {
+			// carol or the bot has won already.
+			return
+		}
+		board = resumed.Board
+	}
+
+	botDiscs := 0
+	for _, row := range board {
+		for _, cell := range row {
+			if cell != 0 && cell != start.Player {
+				botDiscs++
+			}
+		}
+	}
+	if botDiscs == 0 {
+		t.Error("the bot never replied")
+	}
+
+	carol.send(ws.Message{Type: "resign"})
+	carol.waitFor("game_end")
+}
+
+func TestHintSendsColumnZero(t *testing.T) {
+	_, url := newTestServer(t)
+
+	dave := dial(t, url)
+	dave.send(ws.Message{Type: "play_bot", Username: "dave", Difficulty: "easy", FirstPlayer: "me", Position: "7/7/7/7/4o2/1xxxoo1 x"})
+	dave.waitFor("game_start")
+
+	dave.send(ws.Message{Type: "hint"})
+	hint := dave.waitFor("hint").Hint
+	if hint == nil || hint.Column != 0 || hint.Hints != 1 {
+		t.Errorf("hint = %+v, want the win in column 0", hint)
+	}
+}
+
+func TestJoinRoomIgnoresGameOptions(t *testing.T) {
+	_, url := newTestServer(t)
+
+	host := dial(t, url)
+	guest := dial(t, url)
+	host.send(ws.Message{Type: "create_room", Username: "host", Variant: "5x4"})
+	code := host.waitFor("room_created").RoomCode
+
+	// The room's options are the host's; the guest's are not even parsed.
+	guest.send(ws.Message{Type: "join_room", Username: "guest", RoomCode: code, Variant: "nonsense", FirstPlayer: "nonsense"})
+	start := guest.waitFor("game_start")
+	if start.Rules == nil || *start.Rules != game.Variants["5x4"] {
+		t.Errorf("guest started with rules %+v, want the host's 5x4", start.Rules)
+	}
+	host.waitFor("game_start")
+}
+
+func TestSpectatorCannotTakeAPlayersName(t *testing.T) {
+	_, url := newTestServer(t)
+
+	alice := dial(t, url)
+	bob := dial(t, url)
+	alice.send(ws.Message{Type: "join", Username: "alice"})
+	bob.send(ws.Message{Type: "join", Username: "bob"})
+	start := alice.waitFor("game_start")
+	bob.waitFor("game_start")
+
+	eve := dial(t, url)
+	eve.send(ws.Message{Type: "spectate", GameID: start.GameID, Username: "alice"})
+	eve.waitFor("spectate_start")
+	eve.send(ws.Message{Type: "resign"})
+	if msg := eve.waitFor("error", "game_end"); msg.Type != "error" {
+		t.Fatal("a spectator resigned for alice")
+	}
+
+	// eve leaving is not alice leaving, and alice still holds her seat.
+	eve.conn.Close()
+	alice.send(ws.Message{Type: "resign"})
+	winner := ""
+	for _, msg := range bob.collect() {
+		switch msg.Type {
+		case "opponent_disconnected":
+			t.Error("a spectator leaving was reported as alice disconnecting")
+		case "game_end":
+			winner = msg.Winner
+		}
+	}
+	if winner != "bob" {
+		t.Errorf("after alice resigned the winner is %q, want bob", winner)
+	}
+}
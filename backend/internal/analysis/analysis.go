@@ -0,0 +1,213 @@
+package analysis
+
+import (
+	"fmt"
+	"four-in-a-row/internal/bot"
+	"four-in-a-row/internal/game"
+	"four-in-a-row/internal/solver"
+	"time"
+)
+
+type Annotation string
+
+const (
+	Best       Annotation = "best"
+	Good       Annotation = "good"
+	Inaccuracy Annotation = "inaccuracy"
+	Mistake    Annotation = "mistake"
+	Blunder    Annotation = "blunder"
+)
+
+// Engine says what graded a move: the exact solver, or the bot's search
+// where the solver is not available or could not solve the position in time.
+type Engine string
+
+const (
+	EngineSolver Engine = "solver"
+	EngineSearch Engine = "search"
+)
+
+const (
+	// SolveTime is how long the solver gets on each position before the move
+	// is graded by the search instead.
+	SolveTime = time.Second
+
+	// ThinkTime is how long the search spends on each position.
+	ThinkTime = 200 * time.Millisecond
+
+	// A move that scores at most this far below the best move, in bot
+	// evaluation points, gets the matching annotation. Anything worse is a
+	// blunder.
+	GoodLoss       = 25
+	InaccuracyLoss = 75
+	MistakeLoss    = 200
+)
+
+// MoveAnalysis annotates the move played at Ply (counting from 1). Scores
+// are those of the played and the best column from the mover's point of
+// view: solver scores (positive for a win, larger the sooner, 0 for a draw)
+// when Engine is EngineSolver, and search evaluation points otherwise.
+type MoveAnalysis struct {
+	Ply        int        `json:"ply"`
+	Player     int        `json:"player"`
+	Column     int        `json:"column"`
+	Annotation Annotation `json:"annotation"`
+	BestColumn int        `json:"best_column"`
+	Score      int        `json:"score"`
+	BestScore  int        `json:"best_score"`
+	Engine     Engine     `json:"engine"`
+}
+
+// Analyze grades every move against the best one in the position before it.
+// Positions are scored exactly by exact when it plays these rules and solves
+// the position within SolveTime, and by the bot's search otherwise. exact may
+// be nil. The game starts from start, a board string or "" for the empty
+// board. Takebacks are not annotated, so Ply still matches the move's place
+// in moves.
+func Analyze(rules game.Rules, start string, moves []game.Move, exact *solver.Solver) ([]MoveAnalysis, error) {
+	g, err := game.StartingGame(rules, start)
+	if err != nil {
+		return nil, err
+	}
+	if exact != nil && exact.Rules != rules {
+		exact = nil
+	}
+
+	analysts := [2]*bot.Bot{newAnalyst(game.Player1), newAnalyst(game.Player2)}
+	pos := g.Position()
+	results := make([]MoveAnalysis, 0, len(moves))
+
+	for i, move := range moves {
+		if move.Undo {
+			pos.Undo(move.Column)
+			continue
+		}
+
+		if move.Player != pos.CurrentPlayer() || !pos.CanPlay(move.Column) {
+			return nil, fmt.Errorf("move %d is not playable", i+1)
+		}
+
+		if columns, ok := solve(exact, pos); ok {
+			results = append(results, annotateExact(i+1, move, columns))
+		} else {
+			scores := analysts[move.Player-1].ScoreColumns(pos)
+			results = append(results, annotate(i+1, move, scores))
+		}
+		pos.Play(move.Column)
+	}
+
+	return results, nil
+}
+
+func newAnalyst(player int) *bot.Bot {
+	analyst := bot.NewBot(player, bot.Hard)
+	analyst.Level.ThinkTime = ThinkTime
+	return analyst
+}
+
+func solve(exact *solver.Solver, pos *game.Position) ([]solver.ColumnResult, bool) {
+	if exact == nil {
+		return nil, false
+	}
+	columns, err := exact.Analyze(pos, SolveTime)
+	return columns, err == nil
+}
+
+func annotateExact(ply int, move game.Move, columns []solver.ColumnResult) MoveAnalysis {
+	result := MoveAnalysis{
+		Ply:        ply,
+		Player:     move.Player,
+		Column:     move.Column,
+		BestColumn: move.Column,
+		Engine:     EngineSolver,
+	}
+
+	best := columns[0]
+	for _, c := range columns {
+		if c.Column == move.Column {
+			result.Score = c.Score
+		}
+		if c.Score > best.Score {
+			best = c
+		}
+	}
+
+	result.BestScore = best.Score
+	if best.Score > result.Score {
+		result.BestColumn = best.Column
+	}
+	result.Annotation = classifyExact(result.Score, best.Score)
+	return result
+}
+
+// classifyExact grades a move by the outcome it leads to under perfect play.
+// Keeping the outcome but winning more slowly or losing more quickly is
+// good, turning a win into a draw a mistake and turning a win or a draw into
+// a loss a blunder.
+func classifyExact(score, best int) Annotation {
+	switch {
+	case score >= best:
+		return Best
+	case (score > 0) == (best > 0) && (score < 0) == (best < 0):
+		return Good
+	case score == 0:
+		return Mistake
+	}
+	return Blunder
+}
+
+func annotate(ply int, move game.Move, scores []bot.ColumnScore) MoveAnalysis {
+	result := MoveAnalysis{
+		Ply:        ply,
+		Player:     move.Player,
+		Column:     move.Column,
+		BestColumn: move.Column,
+		Engine:     EngineSearch,
+	}
+
+	for _, s := range scores {
+		if s.Column == move.Column {
+			result.Score = s.Score
+		}
+	}
+
+	best := bot.Best(scores)
+
+	result.BestScore = best.Score
+	if best.Score > result.Score {
+		result.BestColumn = best.Column
+	}
+	result.Annotation = classify(result.Score, best.Score)
+	return result
+}
+
+// classify grades a move by how much it gives away compared with the best
+// move. Throwing away a forced win or walking into a forced loss is judged
+// by the outcome rather than by points.
+func classify(score, best int) Annotation {
+	won := func(s int) bool { return bot.IsDecisive(s) && s > 0 }
+	lost := func(s int) bool { return bot.IsDecisive(s) && s < 0 }
+
+	switch {
+	case score >= best:
+		return Best
+	case lost(score) && !lost(best):
+		return Blunder
+	case won(best) && !won(score):
+		return Mistake
+	case won(score) || lost(best):
+		// Winning more slowly, or losing more quickly when the game is lost
+		// anyway, does not change the result.
+		return Good
+	}
+
+	switch loss := best - score; {
+	case loss <= GoodLoss:
+		return Good
+	case loss <= InaccuracyLoss:
+		return Inaccuracy
+	case loss <= MistakeLoss:
+		return Mistake
+	}
+	return Blunder
+}
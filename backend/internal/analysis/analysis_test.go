@@ -0,0 +1,78 @@
+package analysis
+
+import (
+	"four-in-a-row/internal/game"
+	"four-in-a-row/internal/solver"
+	"testing"
+)
+
+func play(rules game.Rules, columns ...int) []game.Move {
+	g := game.NewGame("", "", "", "", "", false, rules)
+	for _, c := range columns {
+		g.MakeMove(c)
+	}
+	return g.Moves
+}
+
+func TestAnalyzeWithSolver(t *testing.T) {
+	rules := game.Variants["5x4"]
+	// Player 2 lets player 1 stack a fourth disc in column 0, and player 1
+	// does not take it.
+	moves := play(rules, 0, 1, 0, 1, 0, 4, 3)
+
+	results, err := Analyze(rules, "", moves, solver.New(rules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(moves) {
+		t.Fatalf("got %d results for %d moves", len(results), len(moves))
+	}
+
+	for _, r := range results {
+		if r.Engine != EngineSolver {
+			t.Errorf("ply %d graded by %q, want the solver", r.Ply, r.Engine)
+		}
+	}
+	if r := results[5]; r.Annotation != Blunder || r.BestColumn != 0 {
+		t.Errorf("ignoring the threat: %+v, want a blunder with best column 0", r)
+	}
+	if r := results[6]; r.Annotation == Best || r.BestColumn != 0 || r.BestScore <= 0 {
+		t.Errorf("missing the win: %+v, want the win in column 0 as best", r)
+	}
+}
+
+func TestAnalyzeFallsBackToSearch(t *testing.T) {
+	rules := game.Variants["8x7"]
+	moves := play(rules, 3, 4, 3, 4)
+
+	// The solver plays another board, so the search grades every move.
+	results, err := Analyze(rules, "", moves, solver.New(game.Variants["5x4"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Engine != EngineSearch {
+			t.Errorf("ply %d graded by %q, want the search", r.Ply, r.Engine)
+		}
+	}
+}
+
+func TestClassifyExact(t *testing.T) {
+	tests := []struct {
+		score, best int
+		want        Annotation
+	}{
+		{3, 3, Best},
+		{0, 0, Best},
+		{2, 5, Good},
+		{-5, -2, Good},
+		{0, 4, Mistake},
+		{-1, 0, Blunder},
+		{-1, 4, Blunder},
+	}
+	for _, tt := range tests {
+		if got := classifyExact(tt.score, tt.best); got != tt.want {
+			t.Errorf("classifyExact(%d, %d) = %s, want %s", tt.score, tt.best, got, tt.want)
+		}
+	}
+}
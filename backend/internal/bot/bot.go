@@ -2,89 +2,116 @@ package bot
 
 import (
 	"four-in-a-row/internal/game"
+	"four-in-a-row/internal/solver"
 	"math"
+	"math/bits"
 	"math/rand"
+	"sync"
 	"time"
 )
 
 const (
-	MaxDepth     = 6
-	WinScore     = 100000
-	BlockScore   = 90000
-	ThreeScore   = 100
-	TwoScore     = 10
-	CenterBonus  = 3
+	DefaultThinkTime = 500 * time.Millisecond
+	WinScore         = 100000
+	BlockScore       = 90000
+	ThreeScore       = 100
+	TwoScore         = 10
+	CenterBonus      = 3
+
+	// SolverShare is the part of the think time the exact solver gets before
+	// the bot falls back to its own search for the rest.
+	SolverShare = 0.75
+
+	infinity   = math.MaxInt32
+	checkEvery = 4096
 )
 
 type Bot struct {
-	Player int
+	Player     int
+	Difficulty Difficulty
+	Level      Level
+	Solver     *solver.Solver
+	table      *transpositionTable
+	mu         sync.Mutex
 }
 
-func NewBot(player int) *Bot {
+type search struct {
+	bot      *Bot
+	opponent int
+	order    []int
+	table    *transpositionTable
+	deadline time.Time
+	nodes    int
+	stopped  bool
+}
+
+func NewBot(player int, difficulty Difficulty) *Bot {
 	rand.Seed(time.Now().UnixNano())
-	return &Bot{Player: player}
+
+	level, ok := Levels[difficulty]
+	if !ok {
+		difficulty = DefaultDifficulty
+		level = Levels[difficulty]
+	}
+
+	return &Bot{
+		Player:     player,
+		Difficulty: difficulty,
+		Level:      level,
+		table:      newTranspositionTable(TableBits),
+	}
 }
 
 func (b *Bot) GetMove(g *game.Game) int {
-	opponent := game.Player1
-	if b.Player == game.Player1 {
-		opponent = game.Player2
-	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pos := g.Position()
+	s := b.newSearch(pos)
 
-	for _, col := range g.GetValidMoves() {
-		clone := g.Clone()
-		clone.CurrentPlayer = b.Player
-		row, valid := clone.MakeMove(col)
-		if valid && clone.Winner == b.Player {
+	for _, col := range s.order {
+		if pos.CanPlay(col) && pos.IsWinningMove(col) {
 			return col
 		}
-		_ = row
 	}
 
-	for _, col := range g.GetValidMoves() {
-		clone := g.Clone()
-		clone.CurrentPlayer = opponent
-		row, valid := clone.MakeMove(col)
-		if valid && clone.Winner == opponent {
-			return col
+	if b.Level.BlunderRate > 0 && rand.Float64() < b.Level.BlunderRate {
+		validMoves := g.GetValidMoves()
+		if len(validMoves) > 0 {
+			return validMoves[rand.Intn(len(validMoves))]
 		}
-		_ = row
 	}
 
-	bestScore := math.MinInt32
-	bestMoves := make([]int, 0)
-
-	for _, col := range g.GetValidMoves() {
-		clone := g.Clone()
-		clone.CurrentPlayer = b.Player
-		_, valid := clone.MakeMove(col)
-		if !valid {
-			continue
+	for _, col := range s.order {
+		if pos.CanPlay(col) && pos.IsOpponentWinningMove(col) {
+			return col
 		}
+	}
 
-		score := b.minimax(clone, MaxDepth-1, math.MinInt32, math.MaxInt32, false, opponent)
-
-		if score > bestScore {
-			bestScore = score
-			bestMoves = []int{col}
-		} else if score == bestScore {
-			bestMoves = append(bestMoves, col)
+	if b.Solver != nil && b.Solver.Rules == pos.Rules() {
+		timeout := time.Duration(float64(b.Level.ThinkTime) * SolverShare)
+		col, err := b.Solver.BestMove(pos, timeout)
+		if err == nil {
+			return col
 		}
 	}
 
+	bestMoves := s.iterate(pos)
+	center := pos.Rules().Columns / 2
+
 	if len(bestMoves) == 0 {
 		validMoves := g.GetValidMoves()
 		if len(validMoves) > 0 {
 			return validMoves[rand.Intn(len(validMoves))]
 		}
-		return 3
+		return center
 	}
 
 	centerPreference := make([]int, 0)
 	for _, col := range bestMoves {
-		if col == 3 {
+		if col == center {
 			centerPreference = append(centerPreference, col, col, col)
-		} else if col == 2 || col == 4 {
+		} else if abs(col-center) == 1 {
 			centerPreference = append(centerPreference, col, col)
 		} else {
 			centerPreference = append(centerPreference, col)
@@ -94,146 +121,243 @@ func (b *Bot) GetMove(g *game.Game) int {
 	return centerPreference[rand.Intn(len(centerPreference))]
 }
 
-func (b *Bot) minimax(g *game.Game, depth int, alpha, beta int, isMaximizing bool, opponent int) int {
-	if g.IsOver || depth == 0 {
-		return b.evaluate(g, opponent)
+func (b *Bot) newSearch(pos *game.Position) *search {
+	opponent := game.Player1
+	if b.Player == game.Player1 {
+		opponent = game.Player2
 	}
 
-	validMoves := g.GetValidMoves()
-	if len(validMoves) == 0 {
-		return 0
+	return &search{
+		bot:      b,
+		opponent: opponent,
+		order:    centerFirst(pos.Rules().Columns),
+		table:    b.table,
+		deadline: time.Now().Add(b.Level.ThinkTime),
 	}
+}
 
-	if isMaximizing {
-		maxScore := math.MinInt32
-		for _, col := range validMoves {
-			clone := g.Clone()
-			clone.CurrentPlayer = b.Player
-			_, valid := clone.MakeMove(col)
-			if !valid {
-				continue
-			}
+func centerFirst(columns int) []int {
+	order := make([]int, 0, columns)
+	center := columns / 2
+	order = append(order, center)
+	for offset := 1; len(order) < columns; offset++ {
+		if center-offset >= 0 {
+			order = append(order, center-offset)
+		}
+		if center+offset < columns {
+			order = append(order, center+offset)
+		}
+	}
+	return order
+}
 
-			score := b.minimax(clone, depth-1, alpha, beta, false, opponent)
-			maxScore = max(maxScore, score)
-			alpha = max(alpha, score)
-			if beta <= alpha {
-				break
-			}
+func (s *search) iterate(pos *game.Position) []int {
+	rules := pos.Rules()
+	maxDepth := rules.Rows*rules.Columns - pos.Moves()
+	if s.bot.Level.MaxDepth > 0 {
+		maxDepth = min(maxDepth, s.bot.Level.MaxDepth)
+	}
+
+	var bestMoves []int
+	for depth := 1; depth <= maxDepth; depth++ {
+		score, moves := s.searchRoot(pos, depth, bestMoves)
+		if s.stopped {
+			break
 		}
-		return maxScore
-	} else {
-		minScore := math.MaxInt32
-		for _, col := range validMoves {
-			clone := g.Clone()
-			clone.CurrentPlayer = opponent
-			_, valid := clone.MakeMove(col)
-			if !valid {
-				continue
-			}
 
-			score := b.minimax(clone, depth-1, alpha, beta, true, opponent)
-			minScore = min(minScore, score)
-			beta = min(beta, score)
-			if beta <= alpha {
-				break
+		bestMoves = moves
+		if IsDecisive(score) {
+			break
+		}
+	}
+
+	return bestMoves
+}
+
+func (s *search) searchRoot(pos *game.Position, depth int, previous []int) (int, []int) {
+	order := s.order
+	if len(previous) > 0 {
+		order = make([]int, 0, len(s.order))
+		order = append(order, previous[0])
+		for _, col := range s.order {
+			if col != previous[0] {
+				order = append(order, col)
 			}
 		}
-		return minScore
 	}
+
+	bestScore := -infinity
+	bestMoves := make([]int, 0)
+
+	for _, col := range order {
+		if !pos.CanPlay(col) {
+			continue
+		}
+
+		pos.Play(col)
+		score := -s.negamax(pos, depth-1, -infinity, -(bestScore - 1))
+		pos.Undo(col)
+
+		if s.stopped {
+			return 0, nil
+		}
+
+		if score > bestScore {
+			bestScore = score
+			bestMoves = []int{col}
+		} else if score == bestScore {
+			bestMoves = append(bestMoves, col)
+		}
+	}
+
+	return bestScore, bestMoves
 }
 
-func (b *Bot) evaluate(g *game.Game, opponent int) int {
-	if g.Winner == b.Player {
-		return WinScore
+func (s *search) negamax(pos *game.Position, depth int, alpha, beta int) int {
+	s.nodes++
+	if s.nodes%checkEvery == 0 && time.Now().After(s.deadline) {
+		s.stopped = true
 	}
-	if g.Winner == opponent {
-		return -WinScore
+	if s.stopped {
+		return 0
 	}
-	if g.IsDraw {
+
+	if pos.IsFull() {
 		return 0
 	}
 
-	score := 0
+	for _, col := range s.order {
+		if pos.CanPlay(col) && pos.IsWinningMove(col) {
+			return WinScore - (pos.Moves() + 1)
+		}
+	}
+
+	if depth == 0 {
+		return s.evaluate(pos)
+	}
 
-	for c := 0; c < game.Columns; c++ {
-		for r := 0; r < game.Rows; r++ {
-			if g.Board[r][c] == b.Player {
-				score += CenterBonus - abs(c-3)
-			} else if g.Board[r][c] == opponent {
-				score -= CenterBonus - abs(c-3)
+	forced := -1
+	for _, col := range s.order {
+		if pos.CanPlay(col) && pos.IsOpponentWinningMove(col) {
+			if forced != -1 {
+				return -(WinScore - (pos.Moves() + 2))
 			}
+			forced = col
 		}
 	}
 
-	score += b.evaluateLines(g, opponent)
+	key := pos.Hash()
+	originalAlpha := alpha
+	hashMove := -1
+
+	if entry, ok := s.table.probe(key); ok {
+		hashMove = int(entry.move)
+		if int(entry.depth) >= depth {
+			score := int(entry.score)
+			switch entry.bound {
+			case boundExact:
+				return score
+			case boundLower:
+				alpha = max(alpha, score)
+			case boundUpper:
+				beta = min(beta, score)
+			}
+			if alpha >= beta {
+				return score
+			}
+		}
+	}
 
-	return score
-}
+	bestScore := -infinity
+	bestMove := -1
 
-func (b *Bot) evaluateLines(g *game.Game, opponent int) int {
-	score := 0
+	for i := -1; i < len(s.order); i++ {
+		col := hashMove
+		if i >= 0 {
+			col = s.order[i]
+			if col == hashMove {
+				continue
+			}
+		}
+		if !pos.CanPlay(col) || (forced != -1 && col != forced) {
+			continue
+		}
+
+		pos.Play(col)
+		score := -s.negamax(pos, depth-1, -beta, -alpha)
+		pos.Undo(col)
 
-	for r := 0; r < game.Rows; r++ {
-		for c := 0; c <= game.Columns-4; c++ {
-			score += b.evaluateWindow(g, r, c, 0, 1, opponent)
+		if s.stopped {
+			return 0
 		}
-	}
 
-	for c := 0; c < game.Columns; c++ {
-		for r := 0; r <= game.Rows-4; r++ {
-			score += b.evaluateWindow(g, r, c, 1, 0, opponent)
+		if score > bestScore {
+			bestScore = score
+			bestMove = col
+		}
+		alpha = max(alpha, score)
+		if alpha >= beta {
+			break
 		}
 	}
 
-	for r := 0; r <= game.Rows-4; r++ {
-		for c := 0; c <= game.Columns-4; c++ {
-			score += b.evaluateWindow(g, r, c, 1, 1, opponent)
-		}
+	bound := boundExact
+	if bestScore <= originalAlpha {
+		bound = boundUpper
+	} else if bestScore >= beta {
+		bound = boundLower
 	}
+	s.table.store(key, depth, bestScore, bound, bestMove)
 
-	for r := 0; r <= game.Rows-4; r++ {
-		for c := 3; c < game.Columns; c++ {
-			score += b.evaluateWindow(g, r, c, 1, -1, opponent)
-		}
+	return bestScore
+}
+
+func (s *search) evaluate(pos *game.Position) int {
+	mine := pos.Stones(s.bot.Player)
+	theirs := pos.Stones(s.opponent)
+	rules := pos.Rules()
+
+	score := 0
+	center := rules.Columns / 2
+
+	for c := 0; c < rules.Columns; c++ {
+		column := pos.ColumnMask(c)
+		weight := CenterBonus - abs(c-center)
+		score += weight * (bits.OnesCount64(mine&column) - bits.OnesCount64(theirs&column))
+	}
+
+	for _, window := range pos.Windows() {
+		score += evaluateWindow(bits.OnesCount64(mine&window), bits.OnesCount64(theirs&window), rules.ConnectN)
 	}
 
+	if noise := s.bot.Level.Noise; noise > 0 {
+		score += rand.Intn(2*noise+1) - noise
+	}
+
+	if pos.CurrentPlayer() != s.bot.Player {
+		return -score
+	}
 	return score
 }
 
-func (b *Bot) evaluateWindow(g *game.Game, startRow, startCol, rowDir, colDir int, opponent int) int {
-	botCount := 0
-	oppCount := 0
-	emptyCount := 0
-
-	for i := 0; i < 4; i++ {
-		r := startRow + i*rowDir
-		c := startCol + i*colDir
-		
-		if g.Board[r][c] == b.Player {
-			botCount++
-		} else if g.Board[r][c] == opponent {
-			oppCount++
-		} else {
-			emptyCount++
-		}
-	}
+func evaluateWindow(botCount, oppCount, n int) int {
+	emptyCount := n - botCount - oppCount
 
 	if botCount > 0 && oppCount > 0 {
 		return 0
 	}
 
-	if botCount == 3 && emptyCount == 1 {
+	if botCount == n-1 && emptyCount == 1 {
 		return ThreeScore
 	}
-	if botCount == 2 && emptyCount == 2 {
+	if botCount == n-2 && emptyCount == 2 {
 		return TwoScore
 	}
 
-	if oppCount == 3 && emptyCount == 1 {
+	if oppCount == n-1 && emptyCount == 1 {
 		return -ThreeScore * 2
 	}
-	if oppCount == 2 && emptyCount == 2 {
+	if oppCount == n-2 && emptyCount == 2 {
 		return -TwoScore
 	}
 
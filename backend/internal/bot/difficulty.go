@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"four-in-a-row/internal/rating"
+	"math"
+	"time"
+)
+
+type Difficulty string
+
+const (
+	Easy   Difficulty = "easy"
+	Medium Difficulty = "medium"
+	Hard   Difficulty = "hard"
+	Expert Difficulty = "expert"
+
+	DefaultDifficulty = Hard
+)
+
+// Level tunes how strong a bot plays. MaxDepth 0 searches as deep as the
+// think time allows, Noise is the largest random offset added to leaf
+// evaluations and BlunderRate is the chance of playing a random column.
+// Rating is the fixed rating players are rated against when they play it.
+type Level struct {
+	MaxDepth    int
+	ThinkTime   time.Duration
+	Noise       int
+	BlunderRate float64
+	Rating      float64
+}
+
+var Levels = map[Difficulty]Level{
+	Easy:   {MaxDepth: 2, ThinkTime: 100 * time.Millisecond, Noise: 60, BlunderRate: 0.25, Rating: 900},
+	Medium: {MaxDepth: 5, ThinkTime: 250 * time.Millisecond, Noise: 20, BlunderRate: 0.08, Rating: 1300},
+	Hard:   {MaxDepth: 0, ThinkTime: DefaultThinkTime, Noise: 0, BlunderRate: 0, Rating: 1700},
+	Expert: {MaxDepth: 0, ThinkTime: 2 * time.Second, Noise: 0, BlunderRate: 0, Rating: 2200},
+}
+
+// BotDeviation is the rating deviation used for bots, whose strength is
+// known and does not drift.
+const BotDeviation = 50
+
+// RatingFor returns the fixed rating of the bot at difficulty, falling back
+// to the default difficulty for unknown values.
+func RatingFor(difficulty Difficulty) rating.Rating {
+	level, ok := Levels[difficulty]
+	if !ok {
+		level = Levels[DefaultDifficulty]
+	}
+	return rating.Rating{
+		Rating:     level.Rating,
+		Deviation:  BotDeviation,
+		Volatility: rating.DefaultVolatility,
+	}
+}
+
+// DifficultyFor picks the difficulty whose bot rating is closest to
+// playerRating.
+func DifficultyFor(playerRating float64) Difficulty {
+	best := DefaultDifficulty
+	bestGap := math.Inf(1)
+	for _, difficulty := range []Difficulty{Easy, Medium, Hard, Expert} {
+		if gap := math.Abs(Levels[difficulty].Rating - playerRating); gap < bestGap {
+			best = difficulty
+			bestGap = gap
+		}
+	}
+	return best
+}
+
+func ParseDifficulty(value string) (Difficulty, bool) {
+	if value == "" {
+		return DefaultDifficulty, true
+	}
+	difficulty := Difficulty(value)
+	_, ok := Levels[difficulty]
+	return difficulty, ok
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"four-in-a-row/internal/game"
+	"sync"
+	"time"
+)
+
+// hintTables are shared between hint searches so that a hint does not
+// allocate a full size table.
+var hintTables = sync.Pool{
+	New: func() any { return newTranspositionTable(HintTableBits) },
+}
+
+// ColumnScore is the search score of playing Column, from the point of view
+// of the player making the move. Scores beyond WinScore-MaxCells are forced
+// wins, and below its negation forced losses.
+type ColumnScore struct {
+	Column int
+	Score  int
+}
+
+// ScoreColumns scores every playable column in pos for the bot, which must be
+// the player to move. It deepens until the think time runs out and returns
+// the scores from the deepest search that finished, in centre-first order.
+func (b *Bot) ScoreColumns(pos *game.Position) []ColumnScore {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.newSearch(pos)
+	rules := pos.Rules()
+	maxDepth := rules.Rows*rules.Columns - pos.Moves()
+	if b.Level.MaxDepth > 0 {
+		maxDepth = min(maxDepth, b.Level.MaxDepth)
+	}
+
+	var scores []ColumnScore
+	for depth := 1; depth <= maxDepth; depth++ {
+		current := s.scoreRoot(pos, depth)
+		if s.stopped {
+			break
+		}
+		scores = current
+	}
+
+	if scores == nil {
+		scores = make([]ColumnScore, 0, rules.Columns)
+		for _, col := range s.order {
+			if pos.CanPlay(col) {
+				scores = append(scores, ColumnScore{Column: col})
+			}
+		}
+	}
+	return scores
+}
+
+// Hint returns the best column for player, who must be the player to move in
+// pos, searching with the hard bot for at most thinkTime.
+func Hint(pos *game.Position, player int, thinkTime time.Duration) ColumnScore {
+	// The table is cleared because the hard bot's scores depend on whose
+	// side it takes, and a pooled table may hold another player's scores.
+	table := hintTables.Get().(*transpositionTable)
+	table.reset()
+	defer hintTables.Put(table)
+
+	hinter := &Bot{Player: player, Difficulty: Hard, Level: Levels[Hard], table: table}
+	hinter.Level.ThinkTime = thinkTime
+	return Best(hinter.ScoreColumns(pos))
+}
+
+// scoreRoot searches every column with a full window, so that each score is
+// exact at depth rather than a bound.
+func (s *search) scoreRoot(pos *game.Position, depth int) []ColumnScore {
+	scores := make([]ColumnScore, 0, len(s.order))
+
+	for _, col := range s.order {
+		if !pos.CanPlay(col) {
+			continue
+		}
+
+		score := WinScore - (pos.Moves() + 1)
+		if !pos.IsWinningMove(col) {
+			pos.Play(col)
+			score = -s.negamax(pos, depth-1, -infinity, infinity)
+			pos.Undo(col)
+		}
+
+		if s.stopped {
+			return nil
+		}
+		scores = append(scores, ColumnScore{Column: col, Score: score})
+	}
+
+	return scores
+}
+
+// Best returns the highest scoring column, taking the first of equal scores,
+// which for ScoreColumns is the one nearest the centre. scores must not be
+// empty.
+func Best(scores []ColumnScore) ColumnScore {
+	best := scores[0]
+	for _, s := range scores[1:] {
+		if s.Score > best.Score {
+			best = s
+		}
+	}
+	return best
+}
+
+// IsDecisive reports whether score is a forced win or loss.
+func IsDecisive(score int) bool {
+	return abs(score) > WinScore-game.MaxCells-1
+}
@@ -0,0 +1,62 @@
+package bot
+
+const TableBits = 18
+
+// HintTableBits sizes the smaller tables used for hint searches.
+const HintTableBits = 14
+
+const (
+	boundExact uint8 = iota + 1
+	boundLower
+	boundUpper
+)
+
+type tableEntry struct {
+	key   uint64
+	score int32
+	depth int8
+	bound uint8
+	move  int8
+}
+
+type transpositionTable struct {
+	entries []tableEntry
+	mask    uint64
+}
+
+func newTranspositionTable(bits uint) *transpositionTable {
+	size := uint64(1) << bits
+	return &transpositionTable{
+		entries: make([]tableEntry, size),
+		mask:    size - 1,
+	}
+}
+
+func (t *transpositionTable) reset() {
+	for i := range t.entries {
+		t.entries[i] = tableEntry{}
+	}
+}
+
+func (t *transpositionTable) probe(key uint64) (tableEntry, bool) {
+	entry := t.entries[key&t.mask]
+	if entry.bound == 0 || entry.key != key {
+		return tableEntry{}, false
+	}
+	return entry, true
+}
+
+func (t *transpositionTable) store(key uint64, depth, score int, bound uint8, move int) {
+	slot := &t.entries[key&t.mask]
+	if slot.key == key && int(slot.depth) > depth {
+		return
+	}
+
+	*slot = tableEntry{
+		key:   key,
+		score: int32(score),
+		depth: int8(depth),
+		bound: bound,
+		move:  int8(move),
+	}
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"four-in-a-row/internal/analysis"
+)
+
+// GetAnalysis returns the cached analysis of a game, or nil if it has not
+// been analysed yet.
+func (d *Database) GetAnalysis(gameID string) ([]analysis.MoveAnalysis, error) {
+	var data []byte
+	err := d.DB.QueryRow(`SELECT moves FROM game_analysis WHERE game_id = $1`, gameID).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	moves := make([]analysis.MoveAnalysis, 0)
+	if err := json.Unmarshal(data, &moves); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+func (d *Database) SaveAnalysis(gameID string, moves []analysis.MoveAnalysis) error {
+	data, err := json.Marshal(moves)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO game_analysis (game_id, moves)
+	VALUES ($1, $2)
+	ON CONFLICT (game_id) DO UPDATE SET moves = EXCLUDED.moves
+	`
+	_, err = d.DB.Exec(query, gameID, data)
+	return err
+}
@@ -3,8 +3,11 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"four-in-a-row/internal/bot"
 	"four-in-a-row/internal/game"
+	"four-in-a-row/internal/rating"
 	"log"
+	"sort"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -21,17 +24,40 @@ type GameRecord struct {
 	Winner      string    `json:"winner"`
 	IsDraw      bool      `json:"is_draw"`
 	IsBot       bool      `json:"is_bot"`
+	Rows        int       `json:"rows"`
+	Columns     int       `json:"columns"`
+	ConnectN    int       `json:"connect_n"`
+	Difficulty  string    `json:"difficulty,omitempty"`
 	MovesJSON   string    `json:"moves"`
+	Hints       int       `json:"hints"`
+	Casual      bool      `json:"casual"`
+	Start       string    `json:"start_position,omitempty"`
 	Duration    int64     `json:"duration"`
 	CompletedAt time.Time `json:"completed_at"`
 }
 
+// LeaderboardMinGames is how many games a player needs before they appear on
+// the leaderboard, so a lucky first win does not put them at the top.
+const LeaderboardMinGames = 5
+
 type LeaderboardEntry struct {
-	Username string `json:"username"`
-	Wins     int    `json:"wins"`
-	Losses   int    `json:"losses"`
-	Draws    int    `json:"draws"`
-	Games    int    `json:"games"`
+	Username        string `json:"username"`
+	Wins            int    `json:"wins"`
+	Losses          int    `json:"losses"`
+	Draws           int    `json:"draws"`
+	Games           int    `json:"games"`
+	Rating          int    `json:"rating"`
+	RatingDeviation int    `json:"rating_deviation"`
+}
+
+type RatingChange struct {
+	GameID          string    `json:"game_id"`
+	Opponent        string    `json:"opponent"`
+	Score           float64   `json:"score"`
+	RatingBefore    float64   `json:"rating_before"`
+	RatingAfter     float64   `json:"rating_after"`
+	RatingDeviation float64   `json:"rating_deviation"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
 func NewDatabase(connStr string) (*Database, error) {
@@ -67,6 +93,24 @@ func (d *Database) createTables() error {
 		completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS board_rows INTEGER DEFAULT 6;
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS board_columns INTEGER DEFAULT 7;
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS connect_n INTEGER DEFAULT 4;
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS difficulty VARCHAR(16);
+
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS player1_id VARCHAR(36);
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS player2_id VARCHAR(36);
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS hints INTEGER DEFAULT 0;
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS casual BOOLEAN DEFAULT FALSE;
+	ALTER TABLE games ADD COLUMN IF NOT EXISTS start_position TEXT;
+
+	CREATE TABLE IF NOT EXISTS users (
+		id VARCHAR(36) PRIMARY KEY,
+		username VARCHAR(50) NOT NULL,
+		password_hash TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
 	CREATE TABLE IF NOT EXISTS leaderboard (
 		username VARCHAR(50) PRIMARY KEY,
 		wins INTEGER DEFAULT 0,
@@ -76,10 +120,42 @@ func (d *Database) createTables() error {
 		last_played TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 	);
 
+	ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS rating DOUBLE PRECISION DEFAULT 1500;
+	ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS rating_deviation DOUBLE PRECISION DEFAULT 350;
+	ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS volatility DOUBLE PRECISION DEFAULT 0.06;
+	ALTER TABLE leaderboard ADD COLUMN IF NOT EXISTS user_id VARCHAR(36) REFERENCES users(id);
+	ALTER TABLE leaderboard DROP CONSTRAINT IF EXISTS leaderboard_pkey;
+
+	CREATE TABLE IF NOT EXISTS rating_history (
+		id SERIAL PRIMARY KEY,
+		game_id VARCHAR(36) NOT NULL,
+		username VARCHAR(50) NOT NULL,
+		opponent VARCHAR(50) NOT NULL,
+		score REAL NOT NULL,
+		rating_before DOUBLE PRECISION NOT NULL,
+		rating_after DOUBLE PRECISION NOT NULL,
+		rating_deviation DOUBLE PRECISION NOT NULL,
+		volatility DOUBLE PRECISION NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	ALTER TABLE rating_history ADD COLUMN IF NOT EXISTS user_id VARCHAR(36);
+
+	CREATE TABLE IF NOT EXISTS game_analysis (
+		game_id VARCHAR(36) PRIMARY KEY REFERENCES games(id),
+		moves JSONB NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users(LOWER(username));
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_leaderboard_user ON leaderboard(user_id);
+	CREATE INDEX IF NOT EXISTS idx_rating_history_user ON rating_history(user_id, created_at);
 	CREATE INDEX IF NOT EXISTS idx_games_player1 ON games(player1);
 	CREATE INDEX IF NOT EXISTS idx_games_player2 ON games(player2);
 	CREATE INDEX IF NOT EXISTS idx_games_completed ON games(completed_at);
 	CREATE INDEX IF NOT EXISTS idx_leaderboard_wins ON leaderboard(wins DESC);
+	CREATE INDEX IF NOT EXISTS idx_leaderboard_rating ON leaderboard(rating DESC);
+	CREATE INDEX IF NOT EXISTS idx_rating_history_username ON rating_history(username, created_at);
 	`
 	_, err := d.DB.Exec(query)
 	return err
@@ -100,73 +176,104 @@ func (d *Database) SaveGame(g *game.Game) error {
 
 	duration := g.EndTime - g.StartTime
 
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-	INSERT INTO games (id, player1, player2, winner, is_draw, is_bot, moves, duration, completed_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	INSERT INTO games (id, player1, player2, winner, is_draw, is_bot, moves, duration, completed_at, board_rows, board_columns, connect_n, difficulty,
+		player1_id, player2_id, hints, casual, start_position)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, ''), NULLIF($14, ''), NULLIF($15, ''), $16, $17, NULLIF($18, ''))
 	ON CONFLICT (id) DO NOTHING
 	`
-	_, err = d.DB.Exec(query, g.ID, g.Player1Name, g.Player2Name, winner, g.IsDraw, g.IsBot, movesJSON, duration, time.Now())
+	result, err := tx.Exec(query, g.ID, g.Player1Name, g.Player2Name, winner, g.IsDraw, g.IsBot, movesJSON, duration, time.Now(),
+		g.Rules.Rows, g.Rules.Columns, g.Rules.ConnectN, g.Difficulty, g.Player1UserID, g.Player2UserID, g.Hints, g.Casual, g.Start)
 	if err != nil {
 		log.Printf("Error saving game: %v", err)
 		return err
 	}
 
-	if err := d.updateLeaderboard(g); err != nil {
-		log.Printf("Error updating leaderboard: %v", err)
+	if inserted, err := result.RowsAffected(); err == nil && inserted == 0 {
+		return nil
 	}
 
-	return nil
-}
+	if !g.Rated() {
+		return tx.Commit()
+	}
 
-func (d *Database) updateLeaderboard(g *game.Game) error {
-	players := []string{g.Player1Name}
-	if !g.IsBot {
-		players = append(players, g.Player2Name)
+	if err := updateLeaderboard(tx, g); err != nil {
+		log.Printf("Error updating leaderboard: %v", err)
+		return err
 	}
 
-	for _, player := range players {
-		if player == "" || player == "Bot" {
+	return tx.Commit()
+}
+
+// updateLeaderboard records the result and the new Glicko-2 rating of every
+// registered player in g; guests are not rated. Both ratings are read before
+// either is written so the players are rated against each other's rating from
+// before the game. Bots are rated at the fixed rating of their difficulty and
+// guests at the default rating.
+func updateLeaderboard(tx *sql.Tx, g *game.Game) error {
+	names := [2]string{g.Player1Name, g.Player2Name}
+	userIDs := [2]string{g.Player1UserID, g.Player2UserID}
+	ratings := [2]rating.Rating{rating.Default(), rating.Default()}
+
+	players := make([]int, 0, 2)
+	for i := range userIDs {
+		if g.IsBot && g.BotPlayer == i+1 {
+			ratings[i] = bot.RatingFor(bot.Difficulty(g.Difficulty))
 			continue
 		}
+		if userIDs[i] != "" {
+			players = append(players, i)
+		}
+	}
 
-		upsertQuery := `
-		INSERT INTO leaderboard (username, wins, losses, draws, games, last_played)
-		VALUES ($1, 0, 0, 0, 0, CURRENT_TIMESTAMP)
-		ON CONFLICT (username) DO NOTHING
-		`
-		d.DB.Exec(upsertQuery, player)
+	// Lock rows in a fixed order so two games saved at once cannot deadlock.
+	sort.Slice(players, func(a, b int) bool {
+		return userIDs[players[a]] < userIDs[players[b]]
+	})
+
+	for _, i := range players {
+		current, err := lockRating(tx, userIDs[i], names[i])
+		if err != nil {
+			return err
+		}
+		ratings[i] = current
+	}
 
-		var updateQuery string
+	for _, i := range players {
+		score := rating.Loss
+		column := "losses"
 		if g.IsDraw {
-			updateQuery = `
-			UPDATE leaderboard 
-			SET draws = draws + 1, games = games + 1, last_played = CURRENT_TIMESTAMP
-			WHERE username = $1
-			`
-		} else {
-			winnerName := ""
-			if g.Winner == game.Player1 {
-				winnerName = g.Player1Name
-			} else if g.Winner == game.Player2 {
-				winnerName = g.Player2Name
-			}
-
-			if player == winnerName {
-				updateQuery = `
-				UPDATE leaderboard 
-				SET wins = wins + 1, games = games + 1, last_played = CURRENT_TIMESTAMP
-				WHERE username = $1
-				`
-			} else {
-				updateQuery = `
-				UPDATE leaderboard 
-				SET losses = losses + 1, games = games + 1, last_played = CURRENT_TIMESTAMP
-				WHERE username = $1
-				`
-			}
+			score = rating.Draw
+			column = "draws"
+		} else if g.Winner == i+1 {
+			score = rating.Win
+			column = "wins"
 		}
 
-		if _, err := d.DB.Exec(updateQuery, player); err != nil {
+		updated := ratings[i].Update(rating.Result{Opponent: ratings[1-i], Score: score})
+
+		updateQuery := `
+		UPDATE leaderboard
+		SET ` + column + ` = ` + column + ` + 1, games = games + 1, rating = $2, rating_deviation = $3, volatility = $4,
+			last_played = CURRENT_TIMESTAMP
+		WHERE user_id = $1
+		`
+		if _, err := tx.Exec(updateQuery, userIDs[i], updated.Rating, updated.Deviation, updated.Volatility); err != nil {
+			return err
+		}
+
+		historyQuery := `
+		INSERT INTO rating_history (game_id, user_id, username, opponent, score, rating_before, rating_after, rating_deviation, volatility)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`
+		if _, err := tx.Exec(historyQuery, g.ID, userIDs[i], names[i], names[1-i], score, ratings[i].Rating, updated.Rating,
+			updated.Deviation, updated.Volatility); err != nil {
 			return err
 		}
 	}
@@ -174,15 +281,37 @@ func (d *Database) updateLeaderboard(g *game.Game) error {
 	return nil
 }
 
+func lockRating(tx *sql.Tx, userID, username string) (rating.Rating, error) {
+	upsertQuery := `
+	INSERT INTO leaderboard (user_id, username, wins, losses, draws, games, last_played)
+	VALUES ($1, $2, 0, 0, 0, 0, CURRENT_TIMESTAMP)
+	ON CONFLICT (user_id) DO NOTHING
+	`
+	if _, err := tx.Exec(upsertQuery, userID, username); err != nil {
+		return rating.Rating{}, err
+	}
+
+	var r rating.Rating
+	selectQuery := `
+	SELECT rating, rating_deviation, volatility
+	FROM leaderboard
+	WHERE user_id = $1
+	FOR UPDATE
+	`
+	err := tx.QueryRow(selectQuery, userID).Scan(&r.Rating, &r.Deviation, &r.Volatility)
+	return r, err
+}
+
 func (d *Database) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 	query := `
-	SELECT username, wins, losses, draws, games
+	SELECT username, wins, losses, draws, games, ROUND(rating)::int, ROUND(rating_deviation)::int
 	FROM leaderboard
-	ORDER BY wins DESC, games ASC
+	WHERE user_id IS NOT NULL AND games >= $2
+	ORDER BY rating DESC, games DESC
 	LIMIT $1
 	`
-	
-	rows, err := d.DB.Query(query, limit)
+
+	rows, err := d.DB.Query(query, limit, LeaderboardMinGames)
 	if err != nil {
 		return nil, err
 	}
@@ -191,7 +320,7 @@ func (d *Database) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 	entries := make([]LeaderboardEntry, 0)
 	for rows.Next() {
 		var entry LeaderboardEntry
-		if err := rows.Scan(&entry.Username, &entry.Wins, &entry.Losses, &entry.Draws, &entry.Games); err != nil {
+		if err := rows.Scan(&entry.Username, &entry.Wins, &entry.Losses, &entry.Draws, &entry.Games, &entry.Rating, &entry.RatingDeviation); err != nil {
 			return nil, err
 		}
 		entries = append(entries, entry)
@@ -202,15 +331,22 @@ func (d *Database) GetLeaderboard(limit int) ([]LeaderboardEntry, error) {
 
 func (d *Database) GetPlayerStats(username string) (*LeaderboardEntry, error) {
 	query := `
-	SELECT username, wins, losses, draws, games
-	FROM leaderboard
-	WHERE username = $1
+	SELECT u.username, COALESCE(l.wins, 0), COALESCE(l.losses, 0), COALESCE(l.draws, 0), COALESCE(l.games, 0),
+		COALESCE(ROUND(l.rating)::int, $2), COALESCE(ROUND(l.rating_deviation)::int, $3)
+	FROM users u
+	LEFT JOIN leaderboard l ON l.user_id = u.id
+	WHERE LOWER(u.username) = LOWER($1)
 	`
-	
+
 	var entry LeaderboardEntry
-	err := d.DB.QueryRow(query, username).Scan(&entry.Username, &entry.Wins, &entry.Losses, &entry.Draws, &entry.Games)
+	err := d.DB.QueryRow(query, username, int(rating.DefaultRating), int(rating.DefaultDeviation)).Scan(&entry.Username, &entry.Wins,
+		&entry.Losses, &entry.Draws, &entry.Games, &entry.Rating, &entry.RatingDeviation)
 	if err == sql.ErrNoRows {
-		return &LeaderboardEntry{Username: username}, nil
+		return &LeaderboardEntry{
+			Username:        username,
+			Rating:          int(rating.DefaultRating),
+			RatingDeviation: int(rating.DefaultDeviation),
+		}, nil
 	}
 	if err != nil {
 		return nil, err
@@ -219,14 +355,71 @@ func (d *Database) GetPlayerStats(username string) (*LeaderboardEntry, error) {
 	return &entry, nil
 }
 
+func (d *Database) GetRating(userID string) (rating.Rating, error) {
+	query := `
+	SELECT rating, rating_deviation, volatility
+	FROM leaderboard
+	WHERE user_id = $1
+	`
+
+	var r rating.Rating
+	err := d.DB.QueryRow(query, userID).Scan(&r.Rating, &r.Deviation, &r.Volatility)
+	if err == sql.ErrNoRows {
+		return rating.Default(), nil
+	}
+	return r, err
+}
+
+func (d *Database) GetRatingHistory(username string, limit int) ([]RatingChange, error) {
+	query := `
+	SELECT h.game_id, h.opponent, h.score, h.rating_before, h.rating_after, h.rating_deviation, h.created_at
+	FROM rating_history h
+	JOIN users u ON u.id = h.user_id
+	WHERE LOWER(u.username) = LOWER($1)
+	ORDER BY h.created_at DESC, h.id DESC
+	LIMIT $2
+	`
+
+	rows, err := d.DB.Query(query, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]RatingChange, 0)
+	for rows.Next() {
+		var change RatingChange
+		if err := rows.Scan(&change.GameID, &change.Opponent, &change.Score, &change.RatingBefore, &change.RatingAfter, &change.RatingDeviation, &change.CreatedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+const gameColumns = `id, player1, player2, COALESCE(winner, ''), is_draw, is_bot, board_rows, board_columns, connect_n,
+	COALESCE(difficulty, ''), COALESCE(moves::text, '[]'), COALESCE(hints, 0), COALESCE(casual, FALSE),
+	COALESCE(start_position, ''), duration, completed_at`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanGame(row scanner) (GameRecord, error) {
+	var record GameRecord
+	err := row.Scan(&record.ID, &record.Player1, &record.Player2, &record.Winner, &record.IsDraw, &record.IsBot, &record.Rows, &record.Columns, &record.ConnectN, &record.Difficulty, &record.MovesJSON, &record.Hints, &record.Casual, &record.Start, &record.Duration, &record.CompletedAt)
+	return record, err
+}
+
 func (d *Database) GetRecentGames(limit int) ([]GameRecord, error) {
 	query := `
-	SELECT id, player1, player2, COALESCE(winner, ''), is_draw, is_bot, COALESCE(moves::text, '[]'), duration, completed_at
+	SELECT ` + gameColumns + `
 	FROM games
 	ORDER BY completed_at DESC
 	LIMIT $1
 	`
-	
+
 	rows, err := d.DB.Query(query, limit)
 	if err != nil {
 		return nil, err
@@ -235,8 +428,8 @@ func (d *Database) GetRecentGames(limit int) ([]GameRecord, error) {
 
 	records := make([]GameRecord, 0)
 	for rows.Next() {
-		var record GameRecord
-		if err := rows.Scan(&record.ID, &record.Player1, &record.Player2, &record.Winner, &record.IsDraw, &record.IsBot, &record.MovesJSON, &record.Duration, &record.CompletedAt); err != nil {
+		record, err := scanGame(rows)
+		if err != nil {
 			return nil, err
 		}
 		records = append(records, record)
@@ -245,6 +438,35 @@ func (d *Database) GetRecentGames(limit int) ([]GameRecord, error) {
 	return records, nil
 }
 
+// GetGame returns the finished game with the given ID, or nil if there is
+// none.
+func (d *Database) GetGame(id string) (*GameRecord, error) {
+	query := `SELECT ` + gameColumns + ` FROM games WHERE id = $1`
+
+	record, err := scanGame(d.DB.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Rules returns the board the game was played on.
+func (r *GameRecord) Rules() game.Rules {
+	return game.Rules{Rows: r.Rows, Columns: r.Columns, ConnectN: r.ConnectN}
+}
+
+// Moves decodes the moves stored with the game.
+func (r *GameRecord) Moves() ([]game.Move, error) {
+	moves := make([]game.Move, 0)
+	if err := json.Unmarshal([]byte(r.MovesJSON), &moves); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
 func (d *Database) Close() error {
 	return d.DB.Close()
 }
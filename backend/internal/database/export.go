@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExportBatchSize is how many games an export fetches from its cursor at a
+// time.
+const ExportBatchSize = 500
+
+// Results a GameFilter can select, written the way PGN writes them.
+const (
+	ResultPlayer1Wins = "1-0"
+	ResultPlayer2Wins = "0-1"
+	ResultDraw        = "1/2-1/2"
+	ResultUnfinished  = "*"
+)
+
+// GameFilter narrows down an export. Zero fields match every game; From is
+// inclusive and To exclusive.
+type GameFilter struct {
+	Player string
+	From   time.Time
+	To     time.Time
+	IsBot  *bool
+	Result string
+}
+
+func (f GameFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if f.Player != "" {
+		add("(LOWER(player1) = LOWER(?) OR LOWER(player2) = LOWER(?))", f.Player)
+	}
+	if !f.From.IsZero() {
+		add("completed_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		add("completed_at < ?", f.To)
+	}
+	if f.IsBot != nil {
+		add("is_bot = ?", *f.IsBot)
+	}
+
+	switch f.Result {
+	case ResultPlayer1Wins:
+		conditions = append(conditions, "winner = player1")
+	case ResultPlayer2Wins:
+		conditions = append(conditions, "winner = player2")
+	case ResultDraw:
+		conditions = append(conditions, "is_draw")
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Result returns the outcome of the game in PGN notation.
+func (r *GameRecord) Result() string {
+	switch {
+	case r.IsDraw:
+		return ResultDraw
+	case r.Winner != "" && r.Winner == r.Player1:
+		return ResultPlayer1Wins
+	case r.Winner != "" && r.Winner == r.Player2:
+		return ResultPlayer2Wins
+	}
+	return ResultUnfinished
+}
+
+// ExportGames calls fn for every game matching filter, oldest first. The
+// games are read through a server-side cursor, so only one batch is held in
+// memory however many there are. It stops at the first error from fn.
+func (d *Database) ExportGames(ctx context.Context, filter GameFilter, fn func(GameRecord) error) error {
+	tx, err := d.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := filter.where()
+	query := `DECLARE game_export NO SCROLL CURSOR FOR
+	SELECT ` + gameColumns + `
+	FROM games` + where + `
+	ORDER BY completed_at, id`
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	for {
+		fetched, err := fetchGames(ctx, tx, fn)
+		if err != nil {
+			return err
+		}
+		if fetched < ExportBatchSize {
+			return nil
+		}
+	}
+}
+
+func fetchGames(ctx context.Context, tx *sql.Tx, fn func(GameRecord) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM game_export", ExportBatchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	fetched := 0
+	for rows.Next() {
+		record, err := scanGame(rows)
+		if err != nil {
+			return fetched, err
+		}
+		fetched++
+
+		if err := fn(record); err != nil {
+			return fetched, err
+		}
+	}
+
+	return fetched, rows.Err()
+}
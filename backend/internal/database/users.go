@@ -0,0 +1,69 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var ErrUsernameTaken = errors.New("username is already taken")
+
+type User struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (d *Database) CreateUser(username, passwordHash string) (*User, error) {
+	user := &User{
+		ID:        uuid.New().String(),
+		Username:  username,
+		CreatedAt: time.Now(),
+	}
+
+	query := `
+	INSERT INTO users (id, username, password_hash, created_at)
+	VALUES ($1, $2, $3, $4)
+	`
+	_, err := d.DB.Exec(query, user.ID, user.Username, passwordHash, user.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUserByUsername returns the user and their password hash, or a nil user
+// if nobody has registered the name. Names are matched case-insensitively.
+func (d *Database) GetUserByUsername(username string) (*User, string, error) {
+	query := `
+	SELECT id, username, password_hash, created_at
+	FROM users
+	WHERE LOWER(username) = LOWER($1)
+	`
+
+	var user User
+	var passwordHash string
+	err := d.DB.QueryRow(query, username).Scan(&user.ID, &user.Username, &passwordHash, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &user, passwordHash, nil
+}
+
+func (d *Database) UsernameRegistered(username string) (bool, error) {
+	var exists bool
+	err := d.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))`, username).Scan(&exists)
+	return exists, err
+}
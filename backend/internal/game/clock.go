@@ -0,0 +1,74 @@
+package game
+
+import "time"
+
+// TimeControl is how much thinking time each player gets, in seconds. With
+// PerMove set every move has Initial seconds and unused time is not carried
+// over; otherwise Initial is a bank for the whole game topped up by
+// Increment after each move. The zero value is an untimed game.
+type TimeControl struct {
+	Initial   int  `json:"initial"`
+	Increment int  `json:"increment"`
+	PerMove   bool `json:"per_move,omitempty"`
+}
+
+var TimeControls = map[string]TimeControl{
+	"30s": {Initial: 30, PerMove: true},
+	"1+0": {Initial: 60},
+	"3+2": {Initial: 180, Increment: 2},
+	"5+3": {Initial: 300, Increment: 3},
+}
+
+func (tc TimeControl) Timed() bool {
+	return tc.Initial > 0
+}
+
+// StartClock gives both players their initial time and starts the clock of
+// the player to move.
+func (g *Game) StartClock(now time.Time) {
+	initial := time.Duration(g.TimeControl.Initial) * time.Second
+	g.Remaining = [2]time.Duration{initial, initial}
+	g.TurnStart = now
+}
+
+// TimeLeft is how much time player has at now, counting the running clock of
+// the player to move. It is only meaningful for timed games.
+func (g *Game) TimeLeft(player int, now time.Time) time.Duration {
+	left := g.Remaining[player-1]
+	if player == g.CurrentPlayer && !g.IsOver {
+		left -= now.Sub(g.TurnStart)
+	}
+	return left
+}
+
+// FlagFallen reports whether the player to move has run out of time.
+func (g *Game) FlagFallen(now time.Time) bool {
+	return g.TimeControl.Timed() && !g.IsOver && g.TimeLeft(g.CurrentPlayer, now) <= 0
+}
+
+// pressClock ends the current player's turn at now. TurnStart is kept for
+// untimed games too, to measure how long each move took.
+func (g *Game) pressClock(now time.Time) {
+	if g.TimeControl.Timed() {
+		i := g.CurrentPlayer - 1
+		if g.TimeControl.PerMove {
+			g.Remaining[i] = time.Duration(g.TimeControl.Initial) * time.Second
+		} else {
+			g.Remaining[i] -= now.Sub(g.TurnStart)
+			g.Remaining[i] += time.Duration(g.TimeControl.Increment) * time.Second
+		}
+	}
+	g.TurnStart = now
+}
+
+// ClockSnapshot returns both players' time left in milliseconds, or nil for
+// an untimed game.
+func (g *Game) ClockSnapshot(now time.Time) []int64 {
+	if !g.TimeControl.Timed() {
+		return nil
+	}
+	return []int64{
+		g.TimeLeft(Player1, now).Milliseconds(),
+		g.TimeLeft(Player2, now).Milliseconds(),
+	}
+}
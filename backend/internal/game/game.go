@@ -1,42 +1,138 @@
 package game
 
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
 const (
-	Rows    = 6
-	Columns = 7
 	Empty   = 0
 	Player1 = 1
 	Player2 = 2
+
+	MinSize     = 4
+	MaxSize     = 10
+	MaxCells    = 64
+	MinConnectN = 3
 )
 
-type Board [Rows][Columns]int
+type Rules struct {
+	Rows     int `json:"rows"`
+	Columns  int `json:"columns"`
+	ConnectN int `json:"connect_n"`
+}
+
+var DefaultRules = Rules{Rows: 6, Columns: 7, ConnectN: 4}
+
+var Variants = map[string]Rules{
+	"classic":  DefaultRules,
+	"5x4":      {Rows: 4, Columns: 5, ConnectN: 4},
+	"8x7":      {Rows: 7, Columns: 8, ConnectN: 4},
+	"9x7":      {Rows: 7, Columns: 9, ConnectN: 4},
+	"connect5": {Rows: 6, Columns: 9, ConnectN: 5},
+}
+
+func init() {
+	for name, rules := range Variants {
+		if err := rules.Validate(); err != nil {
+			panic("variant " + name + ": " + err.Error())
+		}
+	}
+}
+
+// Validate reports whether the rules describe a board the game and the
+// bitboards can handle.
+func (r Rules) Validate() error {
+	if r.Rows < MinSize || r.Rows > MaxSize || r.Columns < MinSize || r.Columns > MaxSize {
+		return errors.New("board must be between 4 and 10 rows and columns")
+	}
+	if r.Rows*r.Columns > MaxCells {
+		return errors.New("board must have at most 64 cells")
+	}
+	if r.ConnectN < MinConnectN || (r.ConnectN > r.Rows && r.ConnectN > r.Columns) {
+		return errors.New("connect length does not fit on the board")
+	}
+	return nil
+}
+
+type Board [][]int
+
+func NewBoard(rows, columns int) Board {
+	board := make(Board, rows)
+	for r := range board {
+		board[r] = make([]int, columns)
+	}
+	return board
+}
+
+func (b Board) Copy() Board {
+	board := make(Board, len(b))
+	for r := range b {
+		board[r] = make([]int, len(b[r]))
+		copy(board[r], b[r])
+	}
+	return board
+}
 
 type Game struct {
 	ID            string
+	Rules         Rules
 	Board         Board
 	CurrentPlayer int
 	Player1ID     string
 	Player2ID     string
 	Player1Name   string
 	Player2Name   string
+	Player1UserID string
+	Player2UserID string
+	Player1Token  string
+	Player2Token  string
 	IsBot         bool
+	BotPlayer     int
+	Difficulty    string
 	Winner        int
 	IsOver        bool
 	IsDraw        bool
 	Moves         []Move
 	StartTime     int64
 	EndTime       int64
+	TimeControl   TimeControl
+	Remaining     [2]time.Duration
+	TurnStart     time.Time
+	DrawOffer     int
+	TakebackOffer int
+	RematchOffer  int
+	Rematched     bool
+	Casual        bool
+	Hints         int
+	Start         string
+	mu            sync.Mutex
+
+	// clocks holds Remaining as it was before each move still on the board,
+	// so that taking a move back gives the time spent on it back too.
+	clocks [][2]time.Duration
 }
 
+// Move is one disc dropped. Timestamp is when the server accepted it and
+// ThinkTime how long the player took since the previous move or the start of
+// the game, both in milliseconds; they are zero for games recorded before
+// moves were timed. A move with Undo set records that the disc at Column and
+// Row, the last one still on the board, was taken back.
 type Move struct {
-	Player int `json:"player"`
-	Column int `json:"column"`
-	Row    int `json:"row"`
+	Player    int   `json:"player"`
+	Column    int   `json:"column"`
+	Row       int   `json:"row"`
+	Timestamp int64 `json:"timestamp,omitempty"`
+	ThinkTime int64 `json:"think_time,omitempty"`
+	Undo      bool  `json:"undo,omitempty"`
 }
 
-func NewGame(id, p1ID, p1Name, p2ID, p2Name string, isBot bool) *Game {
+func NewGame(id, p1ID, p1Name, p2ID, p2Name string, isBot bool, rules Rules) *Game {
 	return &Game{
 		ID:            id,
-		Board:         Board{},
+		Rules:         rules,
+		Board:         NewBoard(rules.Rows, rules.Columns),
 		CurrentPlayer: Player1,
 		Player1ID:     p1ID,
 		Player2ID:     p2ID,
@@ -52,13 +148,25 @@ func NewGame(id, p1ID, p1Name, p2ID, p2Name string, isBot bool) *Game {
 	}
 }
 
+func (g *Game) Lock() {
+	g.mu.Lock()
+}
+
+func (g *Game) Unlock() {
+	g.mu.Unlock()
+}
+
+func (g *Game) BoardSnapshot() Board {
+	return g.Board.Copy()
+}
+
 func (g *Game) MakeMove(column int) (int, bool) {
-	if column < 0 || column >= Columns {
+	if column < 0 || column >= g.Rules.Columns {
 		return -1, false
 	}
 
 	row := -1
-	for r := Rows - 1; r >= 0; r-- {
+	for r := g.Rules.Rows - 1; r >= 0; r-- {
 		if g.Board[r][column] == Empty {
 			row = r
 			break
@@ -69,13 +177,22 @@ func (g *Game) MakeMove(column int) (int, bool) {
 		return -1, false
 	}
 
-	g.Board[row][column] = g.CurrentPlayer
-
+	now := time.Now()
 	move := Move{
-		Player: g.CurrentPlayer,
-		Column: column,
-		Row:    row,
+		Player:    g.CurrentPlayer,
+		Column:    column,
+		Row:       row,
+		Timestamp: now.UnixMilli(),
+	}
+	if !g.TurnStart.IsZero() {
+		move.ThinkTime = now.Sub(g.TurnStart).Milliseconds()
 	}
+
+	g.Board[row][column] = g.CurrentPlayer
+	g.clocks = append(g.clocks, g.Remaining)
+	g.pressClock(now)
+	g.DrawOffer = 0
+	g.TakebackOffer = 0
 	g.Moves = append(g.Moves, move)
 
 	if g.CheckWin(row, column) {
@@ -90,85 +207,129 @@ func (g *Game) MakeMove(column int) (int, bool) {
 		return row, true
 	}
 
-	if g.CurrentPlayer == Player1 {
-		g.CurrentPlayer = Player2
-	} else {
-		g.CurrentPlayer = Player1
-	}
+	g.CurrentPlayer = Opponent(g.CurrentPlayer)
 
 	return row, true
 }
 
-func (g *Game) CheckWin(row, col int) bool {
-	player := g.Board[row][col]
-	
-	count := 0
-	for c := 0; c < Columns; c++ {
-		if g.Board[row][c] == player {
-			count++
-			if count >= 4 {
-				return true
-			}
+// Rated reports whether the result should count towards the players'
+// ratings. Casual games, games where a player took hints from the bot and
+// games started from a set-up position are not rated.
+func (g *Game) Rated() bool {
+	return !g.Casual && g.Hints == 0 && g.Start == ""
+}
+
+// Line returns the moves still on the board in the order they were played,
+// leaving out the ones that were taken back.
+func (g *Game) Line() []Move {
+	return Line(g.Moves)
+}
+
+// Line returns the moves in moves that were not taken back.
+func Line(moves []Move) []Move {
+	line := make([]Move, 0, len(moves))
+	for _, move := range moves {
+		if move.Undo {
+			line = line[:len(line)-1]
 		} else {
-			count = 0
+			line = append(line, move)
 		}
 	}
+	return line
+}
 
-	count = 0
-	for r := 0; r < Rows; r++ {
-		if g.Board[r][col] == player {
-			count++
-			if count >= 4 {
-				return true
-			}
-		} else {
-			count = 0
-		}
+// LastMove returns the most recent move. It must only be called once a move
+// has been made.
+func (g *Game) LastMove() Move {
+	return g.Moves[len(g.Moves)-1]
+}
+
+// UndoMove takes back the last move still on the board, handing the turn
+// back to the player who made it with the time both players had before it,
+// and records the takeback in Moves. It returns false if there is nothing to
+// take back.
+func (g *Game) UndoMove() (Move, bool) {
+	line := g.Line()
+	if len(line) == 0 {
+		return Move{}, false
 	}
+	last := line[len(line)-1]
 
-	count = 0
-	startRow, startCol := row, col
-	for startRow > 0 && startCol > 0 {
-		startRow--
-		startCol--
+	g.Board[last.Row][last.Column] = Empty
+	g.CurrentPlayer = last.Player
+	g.Winner = 0
+	g.IsOver = false
+	g.IsDraw = false
+	g.DrawOffer = 0
+	g.TakebackOffer = 0
+	if n := len(g.clocks); n > 0 {
+		g.Remaining = g.clocks[n-1]
+		g.clocks = g.clocks[:n-1]
 	}
-	for startRow < Rows && startCol < Columns {
-		if g.Board[startRow][startCol] == player {
-			count++
-			if count >= 4 {
-				return true
-			}
-		} else {
-			count = 0
-		}
-		startRow++
-		startCol++
-	}
-
-	count = 0
-	startRow, startCol = row, col
-	for startRow > 0 && startCol < Columns-1 {
-		startRow--
-		startCol++
-	}
-	for startRow < Rows && startCol >= 0 {
-		if g.Board[startRow][startCol] == player {
-			count++
-			if count >= 4 {
-				return true
-			}
-		} else {
-			count = 0
+
+	now := time.Now()
+	g.TurnStart = now
+	g.Moves = append(g.Moves, Move{
+		Player:    last.Player,
+		Column:    last.Column,
+		Row:       last.Row,
+		Timestamp: now.UnixMilli(),
+		Undo:      true,
+	})
+
+	return last, true
+}
+
+func (g *Game) Forfeit(player int) {
+	g.Winner = Opponent(player)
+	g.IsOver = true
+}
+
+// AgreeDraw ends the game as a draw agreed by both players.
+func (g *Game) AgreeDraw() {
+	g.Winner = 0
+	g.IsDraw = true
+	g.IsOver = true
+	g.DrawOffer = 0
+}
+
+func Opponent(player int) int {
+	if player == Player1 {
+		return Player2
+	}
+	return Player1
+}
+
+func (g *Game) CheckWin(row, col int) bool {
+	player := g.Board[row][col]
+	if player == Empty {
+		return false
+	}
+
+	directions := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for _, d := range directions {
+		count := 1 + g.countFrom(row, col, d[0], d[1], player) + g.countFrom(row, col, -d[0], -d[1], player)
+		if count >= g.Rules.ConnectN {
+			return true
 		}
-		startRow++
-		startCol--
 	}
 
 	return false
 }
 
+func (g *Game) countFrom(row, col, rowDir, colDir, player int) int {
+	count := 0
+	r, c := row+rowDir, col+colDir
+	for r >= 0 && r < g.Rules.Rows && c >= 0 && c < g.Rules.Columns && g.Board[r][c] == player {
+		count++
+		r += rowDir
+		c += colDir
+	}
+	return count
+}
+
 func (g *Game) IsBoardFull() bool {
-	for c := 0; c < Columns; c++ {
+	for c := 0; c < g.Rules.Columns; c++ {
 		if g.Board[0][c] == Empty {
 			return false
 		}
@@ -178,7 +339,7 @@ func (g *Game) IsBoardFull() bool {
 
 func (g *Game) GetValidMoves() []int {
 	moves := make([]int, 0)
-	for c := 0; c < Columns; c++ {
+	for c := 0; c < g.Rules.Columns; c++ {
 		if g.Board[0][c] == Empty {
 			moves = append(moves, c)
 		}
@@ -189,27 +350,41 @@ func (g *Game) GetValidMoves() []int {
 func (g *Game) Clone() *Game {
 	clone := &Game{
 		ID:            g.ID,
+		Rules:         g.Rules,
+		Board:         g.Board.Copy(),
 		CurrentPlayer: g.CurrentPlayer,
 		Player1ID:     g.Player1ID,
 		Player2ID:     g.Player2ID,
 		Player1Name:   g.Player1Name,
 		Player2Name:   g.Player2Name,
+		Player1UserID: g.Player1UserID,
+		Player2UserID: g.Player2UserID,
+		Player1Token:  g.Player1Token,
+		Player2Token:  g.Player2Token,
 		IsBot:         g.IsBot,
+		BotPlayer:     g.BotPlayer,
+		Difficulty:    g.Difficulty,
 		Winner:        g.Winner,
 		IsOver:        g.IsOver,
 		IsDraw:        g.IsDraw,
 		StartTime:     g.StartTime,
 		EndTime:       g.EndTime,
+		TimeControl:   g.TimeControl,
+		Remaining:     g.Remaining,
+		TurnStart:     g.TurnStart,
+		DrawOffer:     g.DrawOffer,
+		TakebackOffer: g.TakebackOffer,
+		RematchOffer:  g.RematchOffer,
+		Rematched:     g.Rematched,
+		Casual:        g.Casual,
+		Hints:         g.Hints,
+		Start:         g.Start,
 	}
-	
-	for r := 0; r < Rows; r++ {
-		for c := 0; c < Columns; c++ {
-			clone.Board[r][c] = g.Board[r][c]
-		}
-	}
-	
+
 	clone.Moves = make([]Move, len(g.Moves))
 	copy(clone.Moves, g.Moves)
-	
+	clone.clocks = make([][2]time.Duration, len(g.clocks))
+	copy(clone.clocks, g.clocks)
+
 	return clone
 }
@@ -0,0 +1,66 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUndoMove(t *testing.T) {
+	g := NewGame("", "", "", "", "", false, DefaultRules)
+	if _, ok := g.UndoMove(); ok {
+		t.Fatal("UndoMove took back a move on an empty board")
+	}
+
+	for _, c := range []int{3, 3, 4} {
+		g.MakeMove(c)
+	}
+	undone, ok := g.UndoMove()
+	if !ok || undone.Column != 4 || undone.Player != Player1 {
+		t.Fatalf("UndoMove = %+v, %v; want Player1's move in column 4", undone, ok)
+	}
+	if g.CurrentPlayer != Player1 || g.Board[DefaultRules.Rows-1][4] != Empty {
+		t.Errorf("after the takeback player %d is to move with board %v", g.CurrentPlayer, g.Board)
+	}
+	if len(g.Moves) != 4 || !g.LastMove().Undo || len(g.Line()) != 2 {
+		t.Errorf("moves = %+v, want the takeback recorded after three moves", g.Moves)
+	}
+
+	// Taking back a winning move reopens the game.
+	for _, c := range []int{0, 1, 0, 1, 0, 1, 0} {
+		g.MakeMove(c)
+	}
+	if !g.IsOver {
+		t.Fatal("four in column 0 did not end the game")
+	}
+	if _, ok := g.UndoMove(); !ok || g.IsOver || g.Winner != 0 {
+		t.Errorf("after taking back the win IsOver = %v, Winner = %d", g.IsOver, g.Winner)
+	}
+}
+
+func TestUndoMoveRestoresClocks(t *testing.T) {
+	g := NewGame("", "", "", "", "", false, DefaultRules)
+	g.TimeControl = TimeControls["3+2"]
+	initial := 180 * time.Second
+
+	// Each player spends ten seconds on a move.
+	g.StartClock(time.Now().Add(-10 * time.Second))
+	g.MakeMove(3)
+	afterFirst := g.Remaining
+	g.TurnStart = time.Now().Add(-10 * time.Second)
+	g.MakeMove(3)
+	if g.Remaining[0] >= initial || g.Remaining[1] >= initial {
+		t.Fatalf("remaining = %v after both players used ten seconds", g.Remaining)
+	}
+
+	g.UndoMove()
+	if g.Remaining != afterFirst {
+		t.Errorf("after taking back the reply remaining = %v, want %v", g.Remaining, afterFirst)
+	}
+	g.UndoMove()
+	if g.Remaining != [2]time.Duration{initial, initial} {
+		t.Errorf("after taking back both moves remaining = %v, want %v each", g.Remaining, initial)
+	}
+	if left := g.TimeLeft(Player1, time.Now()); left < initial-time.Second {
+		t.Errorf("player 1's clock restarted with %v", left)
+	}
+}
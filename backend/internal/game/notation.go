@@ -0,0 +1,243 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Move strings list the columns played, numbered from 1, one character per
+// move: "4453" is the notation used by common Connect Four solvers. Boards
+// wider than nine columns number the tenth column "a".
+const columnDigits = "123456789a"
+
+// Board strings describe a position the way FEN does for chess: the rows from
+// top to bottom separated by "/", with "x" for Player1's discs, "o" for
+// Player2's and a number for a run of empty cells, followed by a space and
+// the side to move. The empty classic board is "7/7/7/7/7/7 x".
+const (
+	player1Disc = 'x'
+	player2Disc = 'o'
+)
+
+// FormatMoves writes the moves still on the board as a move string.
+func FormatMoves(moves []Move) string {
+	var b strings.Builder
+	for _, move := range Line(moves) {
+		b.WriteByte(columnDigits[move.Column])
+	}
+	return b.String()
+}
+
+// ParseMoves reads a move string for rules into zero-based columns. Every
+// move must be playable and none may follow a move that ended the game.
+func ParseMoves(rules Rules, s string) ([]int, error) {
+	_, columns, err := playMoves(rules, s)
+	return columns, err
+}
+
+// playMoves plays the move string s out on an empty board.
+func playMoves(rules Rules, s string) (*Game, []int, error) {
+	g := NewGame("", "", "", "", "", false, rules)
+	columns := make([]int, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		column := strings.IndexByte(columnDigits, s[i])
+		if column < 0 || column >= rules.Columns {
+			return nil, nil, fmt.Errorf("move %d: %q is not a column", i+1, s[i])
+		}
+		if g.IsOver {
+			return nil, nil, fmt.Errorf("move %d: the game is already over", i+1)
+		}
+		if _, ok := g.MakeMove(column); !ok {
+			return nil, nil, fmt.Errorf("move %d: column %c is full", i+1, s[i])
+		}
+		columns = append(columns, column)
+	}
+
+	return g, columns, nil
+}
+
+// FormatBoard writes board as a board string with toMove to play.
+func FormatBoard(board Board, toMove int) string {
+	var b strings.Builder
+	for r, row := range board {
+		if r > 0 {
+			b.WriteByte('/')
+		}
+
+		empty := 0
+		for _, cell := range row {
+			if cell == Empty {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				b.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			b.WriteByte(discs[cell])
+		}
+		if empty > 0 {
+			b.WriteString(strconv.Itoa(empty))
+		}
+	}
+
+	b.WriteByte(' ')
+	b.WriteByte(discs[toMove])
+	return b.String()
+}
+
+var discs = map[int]byte{Player1: player1Disc, Player2: player2Disc}
+
+// ParseBoard reads a board string for rules and returns the board and the
+// player to move. The position must be reachable in play and the game must
+// not already be over.
+func ParseBoard(rules Rules, s string) (Board, int, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return nil, 0, errors.New("board string must be the rows followed by the side to move")
+	}
+
+	rows := strings.Split(fields[0], "/")
+	if len(rows) != rules.Rows {
+		return nil, 0, fmt.Errorf("board string has %d rows, expected %d", len(rows), rules.Rows)
+	}
+
+	board := NewBoard(rules.Rows, rules.Columns)
+	counts := [3]int{}
+	for r, row := range rows {
+		c := 0
+		for i := 0; i < len(row); i++ {
+			switch ch := row[i]; {
+			case ch >= '1' && ch <= '9':
+				j := i
+				for j+1 < len(row) && row[j+1] >= '0' && row[j+1] <= '9' {
+					j++
+				}
+				empty, err := strconv.Atoi(row[i : j+1])
+				if err != nil || empty > rules.Columns-c {
+					return nil, 0, fmt.Errorf("row %d has more than %d columns", r+1, rules.Columns)
+				}
+				c += empty
+				i = j
+			case ch == player1Disc || ch == player2Disc:
+				if c >= rules.Columns {
+					return nil, 0, fmt.Errorf("row %d has more than %d columns", r+1, rules.Columns)
+				}
+				player := Player1
+				if ch == player2Disc {
+					player = Player2
+				}
+				board[r][c] = player
+				counts[player]++
+				c++
+			default:
+				return nil, 0, fmt.Errorf("row %d: unexpected %q", r+1, ch)
+			}
+		}
+		if c != rules.Columns {
+			return nil, 0, fmt.Errorf("row %d has %d columns, expected %d", r+1, c, rules.Columns)
+		}
+	}
+
+	toMove := Player1
+	switch fields[1] {
+	case string(player1Disc):
+	case string(player2Disc):
+		toMove = Player2
+	default:
+		return nil, 0, fmt.Errorf("side to move must be %c or %c", player1Disc, player2Disc)
+	}
+
+	if err := checkReachable(rules, board, counts, toMove); err != nil {
+		return nil, 0, err
+	}
+	return board, toMove, nil
+}
+
+func checkReachable(rules Rules, board Board, counts [3]int, toMove int) error {
+	for c := 0; c < rules.Columns; c++ {
+		for r := 1; r < rules.Rows; r++ {
+			if board[r-1][c] != Empty && board[r][c] == Empty {
+				return fmt.Errorf("column %d has a disc above an empty cell", c+1)
+			}
+		}
+	}
+
+	switch counts[Player1] - counts[Player2] {
+	case 0:
+		if toMove != Player1 {
+			return errors.New("x moves first, so it is x to move when both have the same number of discs")
+		}
+	case 1:
+		if toMove != Player2 {
+			return errors.New("x has one more disc, so it is o to move")
+		}
+	default:
+		return errors.New("x must have as many discs as o or one more")
+	}
+
+	g := NewGame("", "", "", "", "", false, rules)
+	g.Board = board
+	for r := range board {
+		for c := range board[r] {
+			if g.CheckWin(r, c) {
+				return errors.New("the game is already over")
+			}
+		}
+	}
+	if g.IsBoardFull() {
+		return errors.New("the board is full")
+	}
+	return nil
+}
+
+// ParsePosition reads either a board string or a move string played out
+// from the empty board, and returns the board and the player to move.
+func ParsePosition(rules Rules, s string) (Board, int, error) {
+	if strings.Contains(s, "/") {
+		return ParseBoard(rules, s)
+	}
+
+	g, _, err := playMoves(rules, s)
+	if err != nil {
+		return nil, 0, err
+	}
+	if g.IsOver {
+		return nil, 0, errors.New("the game is already over")
+	}
+	return g.Board, g.CurrentPlayer, nil
+}
+
+// ToMove returns the player whose turn it is on board. Player1 moves first,
+// so it is their turn whenever both players have dropped as many discs.
+func ToMove(board Board) int {
+	discs := 0
+	for _, row := range board {
+		for _, cell := range row {
+			if cell != Empty {
+				discs++
+			}
+		}
+	}
+	if discs%2 == 0 {
+		return Player1
+	}
+	return Player2
+}
+
+// BoardString returns the game's current position as a board string.
+func (g *Game) BoardString() string {
+	return FormatBoard(g.Board, g.CurrentPlayer)
+}
+
+// SetPosition starts the game from board with toMove to play instead of from
+// an empty board, and records the position in Start. It must be called
+// before any move is made.
+func (g *Game) SetPosition(board Board, toMove int) {
+	g.Board = board.Copy()
+	g.CurrentPlayer = toMove
+	g.Start = FormatBoard(board, toMove)
+}
@@ -0,0 +1,134 @@
+package game
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestParseBoardRejectsMalformedStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		board string
+	}{
+		{"empty", ""},
+		{"no side to move", "7/7/7/7/7/7"},
+		{"extra field", "7/7/7/7/7/7 x x"},
+		{"too few rows", "7/7/7/7/7 x"},
+		{"too many rows", "7/7/7/7/7/7/7 x"},
+		{"short row", "7/7/7/7/7/6 x"},
+		{"long row", "7/7/7/7/7/8 x"},
+		{"disc past the end", "7/7/7/7/7/7x o"},
+		{"run past the end", "7/7/7/7/7/x7 o"},
+		{"overflowing run", "7/7/7/7/7/99999999999999999999xx o"},
+		{"run that overflows int", "7/7/7/7/7/9223372036854775807x o"},
+		{"leading zero", "7/7/7/7/7/07 x"},
+		{"unknown disc", "7/7/7/7/7/3z3 o"},
+		{"unknown side", "7/7/7/7/7/7 z"},
+		{"floating disc", "7/7/7/7/3x3/7 o"},
+		{"wrong side to move", "7/7/7/7/7/3x3 x"},
+		{"too many x", "7/7/7/7/7/xx5 o"},
+		{"too many o", "7/7/7/7/7/oo5 x"},
+		{"four in a row", "7/7/7/7/ooo4/xxxx3 o"},
+		{"four in a column", "7/7/3x3/3xo2/3xo2/3xo2 o"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseBoard(DefaultRules, tt.board); err == nil {
+				t.Errorf("ParseBoard(%q) accepted a malformed board", tt.board)
+			}
+		})
+	}
+}
+
+func TestParseMovesRejectsMalformedStrings(t *testing.T) {
+	for _, s := range []string{"0", "8", "a", "4 4", "4444444", "41414141"} {
+		if _, err := ParseMoves(DefaultRules, s); err == nil {
+			t.Errorf("ParseMoves(%q) accepted a malformed move string", s)
+		}
+	}
+}
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		position string
+		want     string
+	}{
+		{"", "7/7/7/7/7/7 x"},
+		{"4453", "7/7/7/7/3o3/2oxx2 x"},
+		{"4", "7/7/7/7/7/3x3 o"},
+		{"7/7/7/7/7/3x3 o", "7/7/7/7/7/3x3 o"},
+	}
+
+	for _, tt := range tests {
+		board, toMove, err := ParsePosition(DefaultRules, tt.position)
+		if err != nil {
+			t.Errorf("ParsePosition(%q): %v", tt.position, err)
+			continue
+		}
+		if got := FormatBoard(board, toMove); got != tt.want {
+			t.Errorf("ParsePosition(%q) = %q, want %q", tt.position, got, tt.want)
+		}
+	}
+}
+
+func TestNotationRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	rules := Variants["8x7"]
+
+	for i := 0; i < 500; i++ {
+		g := randomGame(rng, rules)
+		if g.IsOver {
+			continue
+		}
+
+		moves := FormatMoves(g.Moves)
+		columns, err := ParseMoves(rules, moves)
+		if err != nil {
+			t.Fatalf("ParseMoves(%q): %v", moves, err)
+		}
+		if len(columns) != len(g.Moves) {
+			t.Fatalf("ParseMoves(%q) read %d moves, want %d", moves, len(columns), len(g.Moves))
+		}
+
+		fen := g.BoardString()
+		board, toMove, err := ParseBoard(rules, fen)
+		if err != nil {
+			t.Fatalf("ParseBoard(%q): %v", fen, err)
+		}
+		if toMove != g.CurrentPlayer || toMove != ToMove(board) {
+			t.Fatalf("ParseBoard(%q) has player %d to move, want %d", fen, toMove, g.CurrentPlayer)
+		}
+		if got := FormatBoard(board, toMove); got != fen {
+			t.Fatalf("FormatBoard(ParseBoard(%q)) = %q", fen, got)
+		}
+	}
+}
+
+func TestFormatMovesWideBoard(t *testing.T) {
+	rules := Rules{Rows: 6, Columns: 10, ConnectN: 4}
+	g := NewGame("", "", "", "", "", false, rules)
+	g.MakeMove(9)
+	g.MakeMove(0)
+
+	if got := FormatMoves(g.Moves); got != "a1" {
+		t.Errorf("FormatMoves = %q, want %q", got, "a1")
+	}
+	if _, err := ParseMoves(rules, "a1"); err != nil {
+		t.Errorf("ParseMoves(%q): %v", "a1", err)
+	}
+	if !strings.HasPrefix(g.BoardString(), "10/") {
+		t.Errorf("BoardString = %q, want an empty top row of 10", g.BoardString())
+	}
+}
+
+// randomGame plays random moves until the game ends or a random stop.
+func randomGame(rng *rand.Rand, rules Rules) *Game {
+	g := NewGame("", "", "", "", "", false, rules)
+	for !g.IsOver && rng.Intn(30) > 0 {
+		valid := g.GetValidMoves()
+		g.MakeMove(valid[rng.Intn(len(valid))])
+	}
+	return g
+}
@@ -0,0 +1,298 @@
+package game
+
+import (
+	"math/bits"
+	"math/rand"
+)
+
+// Position is a bitboard view of a game used by the bot search. Cells are
+// numbered column by column from the bottom, so cell (row r from the bottom,
+// column c) is bit c*Rows + r. Boards are limited to MaxCells so that each
+// side fits in a single uint64.
+type Position struct {
+	geometry *geometry
+	current  uint64
+	mask     uint64
+	heights  []int
+	moves    int
+	hash     uint64
+}
+
+type geometry struct {
+	rules   Rules
+	cells   int
+	shifts  [4]uint
+	starts  [4]uint64
+	columns []uint64
+	bottom  uint64
+	windows []uint64
+}
+
+func newGeometry(rules Rules) *geometry {
+	geom := &geometry{
+		rules:   rules,
+		cells:   rules.Rows * rules.Columns,
+		columns: make([]uint64, rules.Columns),
+	}
+
+	directions := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	n := rules.ConnectN
+
+	for d, dir := range directions {
+		dc, dr := dir[0], dir[1]
+		geom.shifts[d] = uint(dc*rules.Rows + dr)
+
+		for c := 0; c < rules.Columns; c++ {
+			for r := 0; r < rules.Rows; r++ {
+				endC, endR := c+(n-1)*dc, r+(n-1)*dr
+				if endC < 0 || endC >= rules.Columns || endR < 0 || endR >= rules.Rows {
+					continue
+				}
+
+				geom.starts[d] |= cellBit(rules, r, c)
+
+				var window uint64
+				for k := 0; k < n; k++ {
+					window |= cellBit(rules, r+k*dr, c+k*dc)
+				}
+				geom.windows = append(geom.windows, window)
+			}
+		}
+	}
+
+	for c := 0; c < rules.Columns; c++ {
+		geom.bottom |= cellBit(rules, 0, c)
+		for r := 0; r < rules.Rows; r++ {
+			geom.columns[c] |= cellBit(rules, r, c)
+		}
+	}
+
+	return geom
+}
+
+func cellBit(rules Rules, row, column int) uint64 {
+	return 1 << uint(cellIndex(rules, row, column))
+}
+
+func cellIndex(rules Rules, row, column int) int {
+	return column*rules.Rows + row
+}
+
+var zobrist = newZobrist()
+
+func newZobrist() [2][MaxCells]uint64 {
+	var keys [2][MaxCells]uint64
+	rng := rand.New(rand.NewSource(4))
+	for side := range keys {
+		for cell := range keys[side] {
+			keys[side][cell] = rng.Uint64()
+		}
+	}
+	return keys
+}
+
+func NewPosition(rules Rules) *Position {
+	return &Position{
+		geometry: newGeometry(rules),
+		heights:  make([]int, rules.Columns),
+	}
+}
+
+// BoardPosition builds the bitboard for board. The board must be reachable
+// in play: discs stacked from the bottom of each column and Player1 having
+// dropped either as many discs as Player2 or one more.
+func BoardPosition(rules Rules, board Board) *Position {
+	p := NewPosition(rules)
+	var stones [2]uint64
+
+	for c := 0; c < rules.Columns; c++ {
+		for h := 0; h < rules.Rows; h++ {
+			player := board[rules.Rows-1-h][c]
+			if player == Empty {
+				break
+			}
+
+			stones[player-1] |= cellBit(rules, h, c)
+			p.hash ^= zobrist[player-1][cellIndex(rules, h, c)]
+			p.heights[c]++
+			p.moves++
+		}
+	}
+
+	p.mask = stones[0] | stones[1]
+	p.current = stones[p.CurrentPlayer()-1]
+	return p
+}
+
+// Position returns the bitboard of the game's current board.
+func (g *Game) Position() *Position {
+	return BoardPosition(g.Rules, g.Board)
+}
+
+func (p *Position) Rules() Rules {
+	return p.geometry.rules
+}
+
+func (p *Position) Moves() int {
+	return p.moves
+}
+
+func (p *Position) CurrentPlayer() int {
+	if p.moves%2 == 0 {
+		return Player1
+	}
+	return Player2
+}
+
+func (p *Position) IsFull() bool {
+	return p.moves == p.geometry.cells
+}
+
+func (p *Position) CanPlay(column int) bool {
+	return column >= 0 && column < len(p.heights) && p.heights[column] < p.geometry.rules.Rows
+}
+
+func (p *Position) Play(column int) {
+	p.hash ^= zobrist[p.moves%2][cellIndex(p.geometry.rules, p.heights[column], column)]
+	p.current ^= p.mask
+	p.mask |= p.nextCell(column)
+	p.heights[column]++
+	p.moves++
+}
+
+func (p *Position) Undo(column int) {
+	p.moves--
+	p.heights[column]--
+	p.mask &^= p.nextCell(column)
+	p.current ^= p.mask
+	p.hash ^= zobrist[p.moves%2][cellIndex(p.geometry.rules, p.heights[column], column)]
+}
+
+// Hash is the Zobrist hash of the stones on the board.
+func (p *Position) Hash() uint64 {
+	return p.hash
+}
+
+// IsWinningMove reports whether the side to move wins by playing column.
+func (p *Position) IsWinningMove(column int) bool {
+	return p.aligned(p.current | p.nextCell(column))
+}
+
+// IsOpponentWinningMove reports whether the opponent of the side to move
+// would win by playing column, i.e. whether column must be blocked.
+func (p *Position) IsOpponentWinningMove(column int) bool {
+	return p.aligned(p.opponent() | p.nextCell(column))
+}
+
+// LastMoveWon reports whether the move that produced this position won.
+func (p *Position) LastMoveWon() bool {
+	return p.aligned(p.opponent())
+}
+
+// PlayableCells has one bit per non-full column: the cell a stone dropped
+// there would land on.
+func (p *Position) PlayableCells() uint64 {
+	var cells uint64
+	for c := range p.heights {
+		if p.CanPlay(c) {
+			cells |= p.nextCell(c)
+		}
+	}
+	return cells
+}
+
+// WinningCells returns the empty cells, playable or not, that would complete
+// a line for the side to move.
+func (p *Position) WinningCells() uint64 {
+	return p.winningCells(p.current, p.opponent())
+}
+
+func (p *Position) OpponentWinningCells() uint64 {
+	return p.winningCells(p.opponent(), p.current)
+}
+
+// NonLosingMoves returns the playable cells that neither leave an immediate
+// opponent win unblocked nor let the opponent win by playing on top.
+func (p *Position) NonLosingMoves() uint64 {
+	possible := p.PlayableCells()
+	threats := p.OpponentWinningCells()
+
+	if forced := possible & threats; forced != 0 {
+		if bits.OnesCount64(forced) > 1 {
+			return 0
+		}
+		possible = forced
+	}
+
+	return possible &^ ((threats &^ p.geometry.bottom) >> 1)
+}
+
+func (p *Position) Stones(player int) uint64 {
+	if player == p.CurrentPlayer() {
+		return p.current
+	}
+	return p.opponent()
+}
+
+func (p *Position) ColumnMask(column int) uint64 {
+	return p.geometry.columns[column]
+}
+
+// Windows returns every group of ConnectN cells that forms a line on the board.
+func (p *Position) Windows() []uint64 {
+	return p.geometry.windows
+}
+
+func (p *Position) Clone() *Position {
+	clone := *p
+	clone.heights = make([]int, len(p.heights))
+	copy(clone.heights, p.heights)
+	return &clone
+}
+
+func (p *Position) opponent() uint64 {
+	return p.current ^ p.mask
+}
+
+func (p *Position) nextCell(column int) uint64 {
+	return cellBit(p.geometry.rules, p.heights[column], column)
+}
+
+func (p *Position) winningCells(stones, others uint64) uint64 {
+	n := p.geometry.rules.ConnectN
+	var cells uint64
+	var shifted, suffix [MaxSize + 1]uint64
+
+	for d, shift := range p.geometry.shifts {
+		for k := 0; k < n; k++ {
+			shifted[k] = stones >> (uint(k) * shift)
+		}
+
+		suffix[n] = ^uint64(0)
+		for k := n - 1; k >= 0; k-- {
+			suffix[k] = suffix[k+1] & shifted[k]
+		}
+
+		prefix := p.geometry.starts[d]
+		for gap := 0; gap < n; gap++ {
+			cells |= (prefix & suffix[gap+1]) << (uint(gap) * shift)
+			prefix &= shifted[gap]
+		}
+	}
+
+	return cells &^ (stones | others)
+}
+
+func (p *Position) aligned(stones uint64) bool {
+	n := uint(p.geometry.rules.ConnectN)
+	for d, shift := range p.geometry.shifts {
+		m := stones
+		for k := uint(1); k < n; k++ {
+			m &= stones >> (k * shift)
+		}
+		if m&p.geometry.starts[d] != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestPositionMatchesGame plays random games on every variant and checks the
+// bitboard against the board the game keeps.
+func TestPositionMatchesGame(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for name, rules := range Variants {
+		for i := 0; i < 200; i++ {
+			g := NewGame("", "", "", "", "", false, rules)
+			pos := NewPosition(rules)
+
+			for !g.IsOver {
+				valid := g.GetValidMoves()
+				column := valid[rng.Intn(len(valid))]
+
+				if !pos.CanPlay(column) {
+					t.Fatalf("%s: column %d is open on the board but not in the position", name, column)
+				}
+				wins := pos.IsWinningMove(column)
+				pos.Play(column)
+				g.MakeMove(column)
+
+				if wins != (g.Winner != 0) || wins != pos.LastMoveWon() {
+					t.Fatalf("%s %s: IsWinningMove = %v, game winner = %d", name, FormatMoves(g.Moves), wins, g.Winner)
+				}
+				if pos.IsFull() != g.IsBoardFull() {
+					t.Fatalf("%s %s: IsFull = %v", name, FormatMoves(g.Moves), pos.IsFull())
+				}
+
+				fromBoard := BoardPosition(rules, g.Board)
+				if fromBoard.Hash() != pos.Hash() || fromBoard.Moves() != pos.Moves() {
+					t.Fatalf("%s %s: BoardPosition differs from the played position", name, FormatMoves(g.Moves))
+				}
+				if !g.IsOver && pos.CurrentPlayer() != g.CurrentPlayer {
+					t.Fatalf("%s %s: position has player %d to move, game has %d", name, FormatMoves(g.Moves), pos.CurrentPlayer(), g.CurrentPlayer)
+				}
+			}
+		}
+	}
+}
+
+func TestPositionUndo(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	rules := DefaultRules
+	pos := NewPosition(rules)
+
+	var hashes []uint64
+	var columns []int
+	for !pos.IsFull() {
+		var open []int
+		for c := 0; c < rules.Columns; c++ {
+			if pos.CanPlay(c) {
+				open = append(open, c)
+			}
+		}
+		column := open[rng.Intn(len(open))]
+		hashes = append(hashes, pos.Hash())
+		columns = append(columns, column)
+		pos.Play(column)
+	}
+
+	for i := len(columns) - 1; i >= 0; i-- {
+		pos.Undo(columns[i])
+		if pos.Hash() != hashes[i] || pos.Moves() != i {
+			t.Fatalf("undoing to ply %d left hash %x after %d moves, want %x", i, pos.Hash(), pos.Moves(), hashes[i])
+		}
+	}
+	if pos.Hash() != NewPosition(rules).Hash() {
+		t.Error("undoing every move did not restore the empty position")
+	}
+}
+
+func TestPositionThreats(t *testing.T) {
+	// x has three in a row along the bottom with both ends open.
+	board, _, err := ParseBoard(DefaultRules, "7/7/7/7/1oo4/1xxx2o x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := BoardPosition(DefaultRules, board)
+
+	for c := 0; c < DefaultRules.Columns; c++ {
+		if want := c == 0 || c == 4; pos.IsWinningMove(c) != want {
+			t.Errorf("IsWinningMove(%d) = %v, want %v", c, pos.IsWinningMove(c), want)
+		}
+	}
+	if pos.NonLosingMoves() == 0 {
+		t.Error("NonLosingMoves is empty for the player with the threats")
+	}
+
+	pos.Play(6)
+	if pos.NonLosingMoves() != 0 {
+		t.Error("NonLosingMoves allows a move against a double threat")
+	}
+}
@@ -0,0 +1,56 @@
+package game
+
+import "fmt"
+
+// Replay plays moves out from start, a board string or "" for the empty
+// board, and returns the board before the first move followed by the board
+// after each move, so snapshot i is the position after i plies. Takebacks
+// count as plies too.
+func Replay(rules Rules, start string, moves []Move) ([]Board, error) {
+	g, err := StartingGame(rules, start)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]Board, 0, len(moves)+1)
+	snapshots = append(snapshots, g.BoardSnapshot())
+
+	for i, move := range moves {
+		if move.Undo {
+			undone, ok := g.UndoMove()
+			if !ok || undone.Column != move.Column || undone.Row != move.Row {
+				return nil, fmt.Errorf("move %d takes back a move that was not played", i+1)
+			}
+		} else {
+			if g.IsOver || move.Player != g.CurrentPlayer {
+				return nil, fmt.Errorf("move %d is out of turn", i+1)
+			}
+			if _, ok := g.MakeMove(move.Column); !ok {
+				return nil, fmt.Errorf("move %d is not playable", i+1)
+			}
+		}
+		snapshots = append(snapshots, g.BoardSnapshot())
+	}
+
+	return snapshots, nil
+}
+
+// StartingGame returns an unnamed game set up at start, a board string or ""
+// for the empty board. The rules are checked, since they usually come from a
+// stored game.
+func StartingGame(rules Rules, start string) (*Game, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := NewGame("", "", "", "", "", false, rules)
+	if start == "" {
+		return g, nil
+	}
+
+	board, toMove, err := ParseBoard(rules, start)
+	if err != nil {
+		return nil, fmt.Errorf("start position: %w", err)
+	}
+	g.SetPosition(board, toMove)
+	return g, nil
+}
@@ -0,0 +1,93 @@
+package game
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 200; i++ {
+		g := NewGame("", "", "", "", "", false, DefaultRules)
+		var boards []Board
+		boards = append(boards, g.BoardSnapshot())
+		for !g.IsOver && rng.Intn(20) > 0 {
+			if len(g.Line()) > 0 && rng.Intn(4) == 0 {
+				g.UndoMove()
+			} else {
+				valid := g.GetValidMoves()
+				g.MakeMove(valid[rng.Intn(len(valid))])
+			}
+			boards = append(boards, g.BoardSnapshot())
+		}
+
+		snapshots, err := Replay(DefaultRules, "", g.Moves)
+		if err != nil {
+			t.Fatalf("Replay(%+v): %v", g.Moves, err)
+		}
+		if len(snapshots) != len(boards) {
+			t.Fatalf("Replay returned %d snapshots, want %d", len(snapshots), len(boards))
+		}
+		for ply := range boards {
+			if FormatBoard(snapshots[ply], Player1) != FormatBoard(boards[ply], Player1) {
+				t.Fatalf("ply %d: Replay = %v, want %v", ply, snapshots[ply], boards[ply])
+			}
+		}
+	}
+}
+
+func TestReplayFromPosition(t *testing.T) {
+	start := "7/7/7/7/7/3x3 o"
+	moves := []Move{{Player: Player2, Column: 3, Row: 4}, {Player: Player1, Column: 2, Row: 5}}
+
+	snapshots, err := Replay(DefaultRules, start, moves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatBoard(snapshots[2], Player2); got != "7/7/7/7/3o3/2xx3 o" {
+		t.Errorf("final board = %q", got)
+	}
+}
+
+func TestReplayRejectsBadMoves(t *testing.T) {
+	tests := []struct {
+		name  string
+		moves []Move
+	}{
+		{"out of turn", []Move{{Player: Player2, Column: 3}}},
+		{"off the board", []Move{{Player: Player1, Column: 7}}},
+		{"takeback of nothing", []Move{{Player: Player1, Column: 3, Row: 5, Undo: true}}},
+		{"takeback of another move", []Move{
+			{Player: Player1, Column: 3, Row: 5},
+			{Player: Player1, Column: 4, Row: 5, Undo: true},
+		}},
+		{"move after the end", []Move{
+			{Player: Player1, Column: 0}, {Player: Player2, Column: 1},
+			{Player: Player1, Column: 0}, {Player: Player2, Column: 1},
+			{Player: Player1, Column: 0}, {Player: Player2, Column: 1},
+			{Player: Player1, Column: 0}, {Player: Player2, Column: 1},
+		}},
+	}
+
+	for _, tt := range tests {
+		if _, err := Replay(DefaultRules, "", tt.moves); err == nil {
+			t.Errorf("%s: Replay accepted the moves", tt.name)
+		}
+	}
+	if _, err := Replay(DefaultRules, "7/7/7/7/7/7x o", nil); err == nil {
+		t.Error("Replay accepted a malformed start position")
+	}
+}
+
+func TestReplayRejectsInvalidRules(t *testing.T) {
+	for _, rules := range []Rules{
+		{},
+		{Rows: 6, Columns: 7, ConnectN: 8},
+		{Rows: 10, Columns: 10, ConnectN: 4},
+	} {
+		if _, err := Replay(rules, "", nil); err == nil {
+			t.Errorf("Replay accepted rules %+v", rules)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"four-in-a-row/internal/analysis"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxConcurrentAnalyses is how many games are analysed at once. Analysis is
+// CPU bound, so further games wait for a slot.
+const MaxConcurrentAnalyses = 2
+
+// analyses runs game analyses, at most MaxConcurrentAnalyses at a time and
+// at most one per game: requests for a game that is already being analysed
+// wait for that run instead of starting another.
+type analyses struct {
+	mu       sync.Mutex
+	inFlight map[string]*analysisRun
+	slots    chan struct{}
+}
+
+type analysisRun struct {
+	done  chan struct{}
+	moves []analysis.MoveAnalysis
+	err   error
+}
+
+func newAnalyses() *analyses {
+	return &analyses{
+		inFlight: make(map[string]*analysisRun),
+		slots:    make(chan struct{}, MaxConcurrentAnalyses),
+	}
+}
+
+// run starts analyse for gameID unless a run for it is already in flight,
+// and returns the run to wait on.
+func (a *analyses) run(gameID string, analyse func() ([]analysis.MoveAnalysis, error)) *analysisRun {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if run, ok := a.inFlight[gameID]; ok {
+		return run
+	}
+
+	run := &analysisRun{done: make(chan struct{})}
+	a.inFlight[gameID] = run
+
+	go func() {
+		a.slots <- struct{}{}
+		run.moves, run.err = analyse()
+		<-a.slots
+
+		a.mu.Lock()
+		delete(a.inFlight, gameID)
+		a.mu.Unlock()
+		close(run.done)
+	}()
+
+	return run
+}
+
+// GetAnalysis annotates every move of a finished game. The first request
+// runs the solver, or the search for other variants, over the whole game,
+// which takes a few seconds; the result is cached for later ones.
+// Analyses cached before moves recorded their engine were made by the search
+// alone and are redone.
+func (h *Handlers) GetAnalysis(c *gin.Context) {
+	gameID := c.Param("id")
+
+	moves, err := h.DB.GetAnalysis(gameID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analysis"})
+		return
+	}
+
+	if moves == nil || (len(moves) > 0 && moves[0].Engine == "") {
+		detail, ok := h.loadGame(c)
+		if !ok {
+			return
+		}
+
+		run := h.analyses.run(gameID, func() ([]analysis.MoveAnalysis, error) {
+			moves, err := analysis.Analyze(detail.Rules(), detail.Start, detail.Moves, h.Solver)
+			if err != nil {
+				return nil, err
+			}
+			if err := h.DB.SaveAnalysis(gameID, moves); err != nil {
+				log.Printf("Failed to cache analysis of game %s: %v", gameID, err)
+			}
+			return moves, nil
+		})
+
+		select {
+		case <-run.done:
+		case <-c.Request.Context().Done():
+			return
+		}
+
+		if run.err != nil {
+			log.Printf("Failed to analyse game %s: %v", gameID, run.err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyse game"})
+			return
+		}
+		moves = run.moves
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"game_id": gameID,
+		"moves":   moves,
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"four-in-a-row/internal/analysis"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAnalysesRunOncePerGame(t *testing.T) {
+	a := newAnalyses()
+	release := make(chan struct{})
+	var calls int32
+
+	analyse := func() ([]analysis.MoveAnalysis, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return []analysis.MoveAnalysis{{Ply: 1}}, nil
+	}
+
+	runs := make([]*analysisRun, 5)
+	for i := range runs {
+		runs[i] = a.run("game", analyse)
+	}
+	close(release)
+
+	for _, run := range runs {
+		<-run.done
+		if run.err != nil || len(run.moves) != 1 {
+			t.Fatalf("run = %v, %v", run.moves, run.err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("analysed the game %d times, want once", calls)
+	}
+}
+
+func TestAnalysesLimitConcurrency(t *testing.T) {
+	a := newAnalyses()
+	release := make(chan struct{})
+	var running, peak int32
+
+	analyse := func() ([]analysis.MoveAnalysis, error) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+		return nil, nil
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		run := a.run(id, analyse)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-run.done
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if peak > MaxConcurrentAnalyses {
+		t.Errorf("%d analyses ran at once, want at most %d", peak, MaxConcurrentAnalyses)
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"four-in-a-row/internal/database"
+	"four-in-a-row/internal/game"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pgnLineLength is where the move text of a PGN export wraps.
+const pgnLineLength = 80
+
+var exportContentTypes = map[string]string{
+	"ndjson": "application/x-ndjson",
+	"csv":    "text/csv; charset=utf-8",
+	"pgn":    "text/plain; charset=utf-8",
+}
+
+var csvHeader = []string{
+	"id", "player1", "player2", "winner", "result", "is_bot", "difficulty", "rows", "columns", "connect_n",
+	"casual", "hints", "start_position", "moves", "duration", "completed_at",
+}
+
+// ExportedGame is a game as written to an NDJSON export.
+type ExportedGame struct {
+	*database.GameRecord
+	Result string      `json:"result"`
+	Moves  []game.Move `json:"moves"`
+}
+
+// ExportGames streams every game matching the query's filters, oldest first,
+// as newline-delimited JSON (the default), CSV or PGN-like text.
+func (h *Handlers) ExportGames(c *gin.Context) {
+	format := c.DefaultQuery("format", "ndjson")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be ndjson, csv or pgn"})
+		return
+	}
+
+	filter, err := exportFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	out := bufio.NewWriter(c.Writer)
+	flush := out.Flush
+	var write func(*database.GameRecord) error
+	switch format {
+	case "ndjson":
+		encoder := json.NewEncoder(out)
+		write = func(record *database.GameRecord) error {
+			moves, err := record.Moves()
+			if err != nil {
+				return err
+			}
+			return encoder.Encode(ExportedGame{GameRecord: record, Result: record.Result(), Moves: moves})
+		}
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write(csvHeader)
+		write = func(record *database.GameRecord) error {
+			return writeCSVGame(w, record)
+		}
+		flush = func() error {
+			w.Flush()
+			if err := w.Error(); err != nil {
+				return err
+			}
+			return out.Flush()
+		}
+	case "pgn":
+		write = func(record *database.GameRecord) error {
+			return writePGNGame(out, record)
+		}
+	}
+
+	// The status can only be chosen until the first game is written, so a
+	// failure after that just cuts the export short.
+	started := false
+	start := func() {
+		if !started {
+			c.Header("Content-Type", contentType)
+			c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="games.%s"`, format))
+			c.Status(http.StatusOK)
+			started = true
+		}
+	}
+
+	err = h.DB.ExportGames(c.Request.Context(), filter, func(record database.GameRecord) error {
+		start()
+		return write(&record)
+	})
+	if err == nil {
+		start()
+		err = flush()
+	}
+
+	if err != nil {
+		log.Printf("Game export failed: %v", err)
+		if !started {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export games"})
+		}
+	}
+}
+
+func exportFilter(c *gin.Context) (database.GameFilter, error) {
+	filter := database.GameFilter{Player: c.Query("player")}
+
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, value)
+		}
+		if err != nil {
+			return filter, fmt.Errorf("%s must be a date (2006-01-02) or an RFC 3339 time", bound.name)
+		}
+		*bound.dest = t
+	}
+
+	switch c.Query("type") {
+	case "":
+	case "bot":
+		isBot := true
+		filter.IsBot = &isBot
+	case "human":
+		isBot := false
+		filter.IsBot = &isBot
+	default:
+		return filter, fmt.Errorf("type must be bot or human")
+	}
+
+	switch result := c.Query("result"); result {
+	case "", database.ResultPlayer1Wins, database.ResultPlayer2Wins, database.ResultDraw:
+		filter.Result = result
+	default:
+		return filter, fmt.Errorf("result must be 1-0, 0-1 or 1/2-1/2")
+	}
+
+	return filter, nil
+}
+
+func writeCSVGame(w *csv.Writer, record *database.GameRecord) error {
+	moves, err := record.Moves()
+	if err != nil {
+		return err
+	}
+
+	return w.Write([]string{
+		record.ID,
+		record.Player1,
+		record.Player2,
+		record.Winner,
+		record.Result(),
+		strconv.FormatBool(record.IsBot),
+		record.Difficulty,
+		strconv.Itoa(record.Rows),
+		strconv.Itoa(record.Columns),
+		strconv.Itoa(record.ConnectN),
+		strconv.FormatBool(record.Casual),
+		strconv.Itoa(record.Hints),
+		record.Start,
+		game.FormatMoves(moves),
+		strconv.FormatInt(record.Duration, 10),
+		record.CompletedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// writePGNGame writes the game in the layout of a PGN file: tag pairs, a
+// blank line, then the numbered moves (as columns counted from 1) and the
+// result. Takebacks are left out.
+func writePGNGame(w io.Writer, record *database.GameRecord) error {
+	moves, err := record.Moves()
+	if err != nil {
+		return err
+	}
+
+	tags := [][2]string{
+		{"Event", "Four in a Row"},
+		{"Date", record.CompletedAt.UTC().Format("2006.01.02")},
+		{"Player1", record.Player1},
+		{"Player2", record.Player2},
+		{"Result", record.Result()},
+		{"GameID", record.ID},
+		{"Rows", strconv.Itoa(record.Rows)},
+		{"Columns", strconv.Itoa(record.Columns)},
+		{"ConnectN", strconv.Itoa(record.ConnectN)},
+	}
+	if record.IsBot {
+		tags = append(tags, [2]string{"Bot", record.Difficulty})
+	}
+	if record.Casual {
+		tags = append(tags, [2]string{"Casual", "true"})
+	}
+	if record.Start != "" {
+		tags = append(tags, [2]string{"FEN", record.Start})
+	}
+	tags = append(tags, [2]string{"Duration", strconv.FormatInt(record.Duration, 10)})
+
+	var b strings.Builder
+	for _, tag := range tags {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(tag[1])
+		fmt.Fprintf(&b, "[%s \"%s\"]\n", tag[0], value)
+	}
+	b.WriteByte('\n')
+
+	toMove := game.Player1
+	if record.Start != "" {
+		if _, toMove, err = game.ParseBoard(record.Rules(), record.Start); err != nil {
+			return err
+		}
+	}
+
+	tokens := pgnMoveTokens(game.Line(moves), toMove)
+	tokens = append(tokens, record.Result())
+	line := 0
+	for i, token := range tokens {
+		if i > 0 {
+			if line+1+len(token) > pgnLineLength {
+				b.WriteByte('\n')
+				line = 0
+			} else {
+				b.WriteByte(' ')
+				line++
+			}
+		}
+		b.WriteString(token)
+		line += len(token)
+	}
+	b.WriteString("\n\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// pgnMoveTokens numbers the moves in pairs, "1. 4 4 2. 5", starting with
+// "1..." when the game began with Player2 to move.
+func pgnMoveTokens(line []game.Move, toMove int) []string {
+	tokens := make([]string, 0, len(line)*3/2+1)
+
+	ply := 0
+	if toMove == game.Player2 {
+		ply = 1
+		if len(line) > 0 {
+			tokens = append(tokens, "1...")
+		}
+	}
+
+	for _, move := range line {
+		if ply%2 == 0 {
+			tokens = append(tokens, fmt.Sprintf("%d.", ply/2+1))
+		}
+		tokens = append(tokens, game.FormatMoves([]game.Move{move}))
+		ply++
+	}
+	return tokens
+}
@@ -1,18 +1,97 @@
 package handlers
 
 import (
+	"errors"
+	"four-in-a-row/internal/auth"
 	"four-in-a-row/internal/database"
+	"four-in-a-row/internal/solver"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handlers struct {
-	DB *database.Database
+	DB       *database.Database
+	Auth     *auth.Signer
+	Solver   *solver.Solver
+	analyses *analyses
 }
 
-func NewHandlers(db *database.Database) *Handlers {
-	return &Handlers{DB: db}
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func NewHandlers(db *database.Database, signer *auth.Signer, exact *solver.Solver) *Handlers {
+	return &Handlers{DB: db, Auth: signer, Solver: exact, analyses: newAnalyses()}
+}
+
+func (h *Handlers) Register(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if !auth.ValidUsername(req.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username must be 3 to 20 letters, digits, underscores or hyphens"})
+		return
+	}
+	if len(req.Password) < auth.MinPasswordLength || len(req.Password) > auth.MaxPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be between 8 and 72 characters"})
+		return
+	}
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+
+	user, err := h.DB.CreateUser(req.Username, hash)
+	if errors.Is(err, database.ErrUsernameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create account"})
+		return
+	}
+
+	h.respondWithSession(c, http.StatusCreated, user)
+}
+
+func (h *Handlers) Login(c *gin.Context) {
+	var req credentials
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	user, hash, err := h.DB.GetUserByUsername(req.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+	if user == nil || !auth.CheckPassword(hash, req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+
+	h.respondWithSession(c, http.StatusOK, user)
+}
+
+func (h *Handlers) respondWithSession(c *gin.Context, status int, user *database.User) {
+	token, err := h.Auth.Issue(user.ID, user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	c.JSON(status, gin.H{
+		"token": token,
+		"user":  user,
+	})
 }
 
 func (h *Handlers) GetLeaderboard(c *gin.Context) {
@@ -43,6 +122,25 @@ func (h *Handlers) GetPlayerStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+func (h *Handlers) GetRatingHistory(c *gin.Context) {
+	username := c.Param("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required"})
+		return
+	}
+
+	history, err := h.DB.GetRatingHistory(username, 50)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rating history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"username": username,
+		"history":  history,
+	})
+}
+
 func (h *Handlers) GetRecentGames(c *gin.Context) {
 	games, err := h.DB.GetRecentGames(10)
 	if err != nil {
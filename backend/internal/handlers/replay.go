@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"four-in-a-row/internal/database"
+	"four-in-a-row/internal/game"
+	ws "four-in-a-row/internal/websocket"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Replays play each move after the time it took in the original game,
+	// divided by the requested speed and cut to ReplayMaxDelay so that long
+	// thinks do not stall the replay. Games recorded before moves were timed
+	// use the average time per move, kept within both bounds.
+	ReplayMinDelay = 250 * time.Millisecond
+	ReplayMaxDelay = 3 * time.Second
+	MaxReplaySpeed = 16.0
+)
+
+var replayUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// GameDetail is a finished game with its moves decoded and the board after
+// every ply; Snapshots[0] is the starting board.
+type GameDetail struct {
+	*database.GameRecord
+	Moves     []game.Move  `json:"moves"`
+	Snapshots []game.Board `json:"snapshots"`
+}
+
+// GetGame returns a finished game. With ?format=moves it returns the game in
+// notation instead: the start position and final position as board strings
+// and the moves as a move string.
+func (h *Handlers) GetGame(c *gin.Context) {
+	format := c.Query("format")
+	if format != "" && format != "moves" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be moves"})
+		return
+	}
+
+	detail, ok := h.loadGame(c)
+	if !ok {
+		return
+	}
+
+	if format == "moves" {
+		start := detail.Start
+		if start == "" {
+			start = game.FormatBoard(detail.Snapshots[0], game.Player1)
+		}
+		final := detail.Snapshots[len(detail.Snapshots)-1]
+
+		c.JSON(http.StatusOK, gin.H{
+			"game_id":        detail.ID,
+			"start_position": start,
+			"moves":          game.FormatMoves(detail.Moves),
+			"position":       game.FormatBoard(final, game.ToMove(final)),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// StreamReplay upgrades to a websocket and plays the game back move by move:
+// a replay_start message with the players and the starting board, a
+// replay_move for every move (replay_takeback for takebacks) and a
+// replay_end with the result.
+func (h *Handlers) StreamReplay(c *gin.Context) {
+	speed := 1.0
+	if value := c.Query("speed"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > MaxReplaySpeed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "speed must be a number between 0 and 16"})
+			return
+		}
+		speed = parsed
+	}
+
+	detail, ok := h.loadGame(c)
+	if !ok {
+		return
+	}
+
+	conn, err := replayUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Replay upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	rules := detail.Rules()
+	err = conn.WriteJSON(&ws.Message{
+		Type:       "replay_start",
+		GameID:     detail.ID,
+		Players:    []string{detail.Player1, detail.Player2},
+		Rules:      &rules,
+		IsBot:      detail.IsBot,
+		Difficulty: detail.Difficulty,
+		Board:      detail.Snapshots[0],
+	})
+	if err != nil {
+		return
+	}
+
+	averageDelay := replayDelay(detail, speed)
+	for i, move := range detail.Moves {
+		select {
+		case <-closed:
+			return
+		case <-time.After(moveDelay(move, averageDelay, speed)):
+		}
+
+		messageType := "replay_move"
+		if move.Undo {
+			messageType = "replay_takeback"
+		}
+
+		err := conn.WriteJSON(&ws.Message{
+			Type:   messageType,
+			GameID: detail.ID,
+			Column: move.Column,
+			Row:    move.Row,
+			Player: move.Player,
+			Board:  detail.Snapshots[i+1],
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	conn.WriteJSON(&ws.Message{
+		Type:   "replay_end",
+		GameID: detail.ID,
+		Winner: detail.Winner,
+	})
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+// loadGame fetches the game named in the request and replays its moves,
+// responding with an error itself if it cannot.
+func (h *Handlers) loadGame(c *gin.Context) (*GameDetail, bool) {
+	record, err := h.DB.GetGame(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch game"})
+		return nil, false
+	}
+	if record == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
+		return nil, false
+	}
+
+	moves, err := record.Moves()
+	var snapshots []game.Board
+	if err == nil {
+		snapshots, err = game.Replay(record.Rules(), record.Start, moves)
+	}
+	if err != nil {
+		log.Printf("Failed to replay game %s: %v", record.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Game record is corrupt"})
+		return nil, false
+	}
+
+	return &GameDetail{GameRecord: record, Moves: moves, Snapshots: snapshots}, true
+}
+
+// moveDelay is how long a replay waits before playing move: the time the
+// move took at the given speed, at most ReplayMaxDelay, or average if the
+// move was not timed.
+func moveDelay(move game.Move, average time.Duration, speed float64) time.Duration {
+	if move.Timestamp == 0 {
+		return average
+	}
+	return min(time.Duration(float64(move.ThinkTime)*float64(time.Millisecond)/speed), ReplayMaxDelay)
+}
+
+func replayDelay(detail *GameDetail, speed float64) time.Duration {
+	if len(detail.Moves) == 0 {
+		return 0
+	}
+
+	delay := time.Duration(float64(detail.Duration) * float64(time.Second) / float64(len(detail.Moves)) / speed)
+	if delay < ReplayMinDelay {
+		return ReplayMinDelay
+	}
+	if delay > ReplayMaxDelay {
+		return ReplayMaxDelay
+	}
+	return delay
+}
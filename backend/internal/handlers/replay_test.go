@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"four-in-a-row/internal/game"
+	"testing"
+	"time"
+)
+
+func TestMoveDelay(t *testing.T) {
+	average := time.Second
+	tests := []struct {
+		move  game.Move
+		speed float64
+		want  time.Duration
+	}{
+		{game.Move{}, 1, average},
+		{game.Move{Timestamp: 1, ThinkTime: 1500}, 1, 1500 * time.Millisecond},
+		{game.Move{Timestamp: 1, ThinkTime: 1500}, 2, 750 * time.Millisecond},
+		{game.Move{Timestamp: 1, ThinkTime: 0}, 1, 0},
+		{game.Move{Timestamp: 1, ThinkTime: 600000}, 1, ReplayMaxDelay},
+		{game.Move{Timestamp: 1, ThinkTime: 600000}, MaxReplaySpeed, ReplayMaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := moveDelay(tt.move, average, tt.speed); got != tt.want {
+			t.Errorf("moveDelay(%+v, speed %v) = %v, want %v", tt.move, tt.speed, got, tt.want)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package matchmaking
 
 import (
+	"four-in-a-row/internal/auth"
 	"four-in-a-row/internal/bot"
 	"four-in-a-row/internal/game"
+	"four-in-a-row/internal/rating"
 	ws "four-in-a-row/internal/websocket"
 	"log"
+	"math"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -13,65 +17,280 @@ import (
 
 const (
 	MatchTimeout = 10 * time.Second
+	QueueTick    = time.Second
+
+	// Players are paired when their ratings are within the wider of their
+	// two bands. A band starts at InitialRatingBand and grows by
+	// RatingBandGrowth for every second spent in the queue.
+	InitialRatingBand = 100.0
+	RatingBandGrowth  = 50.0
 )
 
+type FirstPlayer string
+
+const (
+	FirstPlayerMe     FirstPlayer = "me"
+	FirstPlayerBot    FirstPlayer = "bot"
+	FirstPlayerRandom FirstPlayer = "random"
+)
+
+// ParseFirstPlayer maps the join option onto a FirstPlayer. An empty value
+// keeps the default of the human moving first.
+func ParseFirstPlayer(value string) (FirstPlayer, bool) {
+	switch FirstPlayer(value) {
+	case "":
+		return FirstPlayerMe, true
+	case FirstPlayerMe, FirstPlayerBot, FirstPlayerRandom:
+		return FirstPlayer(value), true
+	}
+	return "", false
+}
+
+// Options are what a player asked for when joining. Casual games are not
+// rated and allow takebacks. Bot games may start from a set-up position,
+// Start with StartPlayer to move; a nil Start is the empty board.
+type Options struct {
+	Rules       game.Rules
+	TimeControl game.TimeControl
+	Casual      bool
+	Difficulty  bot.Difficulty
+	FirstPlayer FirstPlayer
+	Start       game.Board
+	StartPlayer int
+}
+
+// sameGame reports whether players who asked for o and other can be paired.
+func (o Options) sameGame(other Options) bool {
+	return o.Rules == other.Rules && o.TimeControl == other.TimeControl && o.Casual == other.Casual
+}
+
+// botSeat picks which seat the bot takes in a bot game. Player1 moves first
+// on an empty board; from a set-up position the first player is whoever is
+// to move.
+func (o Options) botSeat() int {
+	seat := game.Player2
+	switch o.FirstPlayer {
+	case FirstPlayerBot:
+		seat = game.Player1
+	case FirstPlayerRandom:
+		if rand.Intn(2) == 0 {
+			seat = game.Player1
+		}
+	}
+
+	if o.Start != nil && o.StartPlayer == game.Player2 {
+		return game.Opponent(seat)
+	}
+	return seat
+}
+
 type WaitingPlayer struct {
-	Client    *ws.Client
-	JoinedAt  time.Time
-	Timer     *time.Timer
+	Client   *ws.Client
+	Options  Options
+	Rating   float64
+	JoinedAt time.Time
+	Timer    *time.Timer
+}
+
+// band is how far apart in rating wp accepts an opponent at now.
+func (wp *WaitingPlayer) band(now time.Time) float64 {
+	return InitialRatingBand + RatingBandGrowth*now.Sub(wp.JoinedAt).Seconds()
 }
 
 type MatchMaker struct {
-	Hub           *ws.Hub
-	WaitingQueue  []*WaitingPlayer
-	mu            sync.Mutex
-	OnGameStart   func(g *game.Game, p1Client, p2Client *ws.Client)
-	OnBotMove     func(g *game.Game, botPlayer *bot.Bot)
+	Hub          *ws.Hub
+	WaitingQueue []*WaitingPlayer
+	Rooms        map[string]*Room
+	mu           sync.Mutex
+	OnGameStart  func(g *game.Game, p1Client, p2Client *ws.Client)
+	OnBotMove    func(g *game.Game, botPlayer *bot.Bot)
+	GetRating    func(userID string) float64
 }
 
 func NewMatchMaker(hub *ws.Hub) *MatchMaker {
 	return &MatchMaker{
 		Hub:          hub,
 		WaitingQueue: make([]*WaitingPlayer, 0),
+		Rooms:        make(map[string]*Room),
 	}
 }
 
-func (m *MatchMaker) AddPlayer(client *ws.Client) {
+// Run pairs waiting players as their rating bands widen and keeps them
+// informed of their place in the queue.
+func (m *MatchMaker) Run() {
+	ticker := time.NewTicker(QueueTick)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.matchWaiting()
+	}
+}
+
+func (m *MatchMaker) AddPlayer(client *ws.Client, opts Options) {
+	playerRating := m.rating(client.GetUserID())
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for i, wp := range m.WaitingQueue {
-		if wp.Client.ID != client.ID && wp.Client.Username != client.Username {
-			wp.Timer.Stop()
-			m.WaitingQueue = append(m.WaitingQueue[:i], m.WaitingQueue[i+1:]...)
-			
-			go m.startGame(wp.Client, client, false)
-			return
-		}
+	m.removeFromQueue(client.ID)
+	m.closeRooms(client.ID)
+
+	now := time.Now()
+	wp := &WaitingPlayer{
+		Client:   client,
+		Options:  opts,
+		Rating:   playerRating,
+		JoinedAt: now,
 	}
 
-	timer := time.AfterFunc(MatchTimeout, func() {
-		m.handleTimeout(client)
-	})
+	if opponent := m.findOpponent(wp, now); opponent != nil {
+		m.removeFromQueue(opponent.Client.ID)
+		go m.startGame(opponent.Client, client, false, opponent.Options)
+		return
+	}
 
-	m.WaitingQueue = append(m.WaitingQueue, &WaitingPlayer{
-		Client:   client,
-		JoinedAt: time.Now(),
-		Timer:    timer,
+	wp.Timer = time.AfterFunc(MatchTimeout, func() {
+		m.handleTimeout(wp)
 	})
+	m.WaitingQueue = append(m.WaitingQueue, wp)
+	m.sendWaiting(wp, now)
+
+	log.Printf("Player %s (%.0f) added to queue, queue size: %d", client.GetUsername(), playerRating, len(m.WaitingQueue))
+}
+
+func (m *MatchMaker) rating(userID string) float64 {
+	if m.GetRating == nil {
+		return rating.DefaultRating
+	}
+	return m.GetRating(userID)
+}
+
+// findOpponent returns the waiting player closest in rating to wp that wp can
+// be paired with at now. It must be called with m.mu held.
+func (m *MatchMaker) findOpponent(wp *WaitingPlayer, now time.Time) *WaitingPlayer {
+	var best *WaitingPlayer
+	bestGap := math.Inf(1)
+
+	for _, other := range m.WaitingQueue {
+		if !compatible(wp, other) {
+			continue
+		}
+
+		gap := math.Abs(wp.Rating - other.Rating)
+		if gap <= math.Max(wp.band(now), other.band(now)) && gap < bestGap {
+			best = other
+			bestGap = gap
+		}
+	}
+
+	return best
+}
+
+func compatible(a, b *WaitingPlayer) bool {
+	return a.Client.ID != b.Client.ID &&
+		a.Client.GetUsername() != b.Client.GetUsername() &&
+		a.Options.sameGame(b.Options)
+}
+
+func (m *MatchMaker) matchWaiting() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	m.Hub.SendToClient(client.ID, &ws.Message{
-		Type:    "waiting",
-		Message: "Looking for an opponent...",
+	now := time.Now()
+	for i := 0; i < len(m.WaitingQueue); i++ {
+		wp := m.WaitingQueue[i]
+		opponent := m.findOpponent(wp, now)
+		if opponent == nil {
+			continue
+		}
+
+		m.removeFromQueue(wp.Client.ID)
+		m.removeFromQueue(opponent.Client.ID)
+		go m.startGame(wp.Client, opponent.Client, false, wp.Options)
+		i = -1
+	}
+
+	for _, wp := range m.WaitingQueue {
+		m.sendWaiting(wp, now)
+	}
+}
+
+// sendWaiting tells wp where it stands in the queue for its board and how
+// long it is likely to wait. It must be called with m.mu held.
+func (m *MatchMaker) sendWaiting(wp *WaitingPlayer, now time.Time) {
+	position := 0
+	for _, other := range m.WaitingQueue {
+		if other.Options.sameGame(wp.Options) {
+			position++
+		}
+		if other == wp {
+			break
+		}
+	}
+
+	m.Hub.SendToClient(wp.Client.ID, &ws.Message{
+		Type:          "waiting",
+		Message:       "Looking for an opponent...",
+		QueuePosition: position,
+		EstimatedWait: int(math.Ceil(m.estimateWait(wp, now).Seconds())),
 	})
+}
+
+// estimateWait is the time until wp's band reaches the closest compatible
+// player in the queue, or until it falls back to a bot if that is sooner.
+func (m *MatchMaker) estimateWait(wp *WaitingPlayer, now time.Time) time.Duration {
+	wait := MatchTimeout - now.Sub(wp.JoinedAt)
 
-	log.Printf("Player %s added to queue, queue size: %d", client.Username, len(m.WaitingQueue))
+	for _, other := range m.WaitingQueue {
+		if !compatible(wp, other) {
+			continue
+		}
+
+		band := math.Max(wp.band(now), other.band(now))
+		gap := math.Abs(wp.Rating - other.Rating)
+		needed := time.Duration((gap - band) / RatingBandGrowth * float64(time.Second))
+		if needed < wait {
+			wait = needed
+		}
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	return wait
 }
 
+// StartBotGame starts a bot game straight away, taking the client out of the
+// queue if it was waiting there. Without a chosen difficulty the bot is
+// picked to match the player's rating.
+func (m *MatchMaker) StartBotGame(client *ws.Client, opts Options) {
+	m.RemovePlayer(client.ID)
+	if opts.Difficulty == "" {
+		opts.Difficulty = bot.DifficultyFor(m.rating(client.GetUserID()))
+	}
+	log.Printf("Starting bot game for %s", client.GetUsername())
+	m.startGame(client, nil, true, opts)
+}
+
+// StartRematch starts a game between two players who agreed to play again.
+func (m *MatchMaker) StartRematch(player1, player2 *ws.Client, opts Options) {
+	m.RemovePlayer(player1.ID)
+	m.RemovePlayer(player2.ID)
+	m.startGame(player1, player2, false, opts)
+}
+
+// RemovePlayer takes the client out of the queue and closes any room it is
+// hosting.
 func (m *MatchMaker) RemovePlayer(clientID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.removeFromQueue(clientID)
+	m.closeRooms(clientID)
+}
+
+// removeFromQueue must be called with m.mu held.
+func (m *MatchMaker) removeFromQueue(clientID string) {
 	for i, wp := range m.WaitingQueue {
 		if wp.Client.ID == clientID {
 			wp.Timer.Stop()
@@ -82,12 +301,12 @@ func (m *MatchMaker) RemovePlayer(clientID string) {
 	}
 }
 
-func (m *MatchMaker) handleTimeout(client *ws.Client) {
+func (m *MatchMaker) handleTimeout(wp *WaitingPlayer) {
 	m.mu.Lock()
-	
+
 	found := false
-	for i, wp := range m.WaitingQueue {
-		if wp.Client.ID == client.ID {
+	for i, other := range m.WaitingQueue {
+		if other == wp {
 			m.WaitingQueue = append(m.WaitingQueue[:i], m.WaitingQueue[i+1:]...)
 			found = true
 			break
@@ -96,66 +315,141 @@ func (m *MatchMaker) handleTimeout(client *ws.Client) {
 	m.mu.Unlock()
 
 	if found {
-		log.Printf("No opponent found for %s, starting bot game", client.Username)
-		m.startGame(client, nil, true)
+		opts := wp.Options
+		if opts.Difficulty == "" {
+			opts.Difficulty = bot.DifficultyFor(wp.Rating)
+		}
+
+		log.Printf("No opponent found for %s, starting %s bot game", wp.Client.GetUsername(), opts.Difficulty)
+		m.startGame(wp.Client, nil, true, opts)
 	}
 }
 
-func (m *MatchMaker) startGame(player1 *ws.Client, player2 *ws.Client, isBot bool) {
+// startGame seats player1 and player2 in order. For bot games player2 is nil
+// and player1 is the human, who may end up in either seat.
+func (m *MatchMaker) startGame(player1 *ws.Client, player2 *ws.Client, isBot bool, opts Options) {
 	gameID := uuid.New().String()
-	
-	p2ID := ""
-	p2Name := "Bot"
-	if player2 != nil {
-		p2ID = player2.ID
-		p2Name = player2.Username
-	} else {
-		p2ID = "bot-" + gameID
+
+	seats := [2]*ws.Client{player1, player2}
+	ids := [2]string{}
+	names := [2]string{}
+	userIDs := [2]string{}
+	botSeat := 0
+
+	if isBot {
+		botSeat = opts.botSeat()
+		if botSeat == game.Player1 {
+			seats = [2]*ws.Client{nil, player1}
+		}
+	}
+
+	tokens := [2]string{}
+	for i, client := range seats {
+		if client != nil {
+			token, err := auth.NewSeatToken()
+			if err != nil {
+				log.Printf("Failed to create reconnect token: %v", err)
+				m.abortStart(seats)
+				return
+			}
+
+			ids[i] = client.ID
+			names[i] = client.GetUsername()
+			userIDs[i] = client.GetUserID()
+			tokens[i] = token
+		} else {
+			ids[i] = "bot-" + gameID
+			names[i] = "Bot"
+		}
 	}
 
 	newGame := game.NewGame(
 		gameID,
-		player1.ID,
-		player1.Username,
-		p2ID,
-		p2Name,
+		ids[0],
+		names[0],
+		ids[1],
+		names[1],
 		isBot,
+		opts.Rules,
 	)
-	newGame.StartTime = time.Now().Unix()
+	now := time.Now()
+	newGame.StartTime = now.Unix()
+	newGame.BotPlayer = botSeat
+	newGame.Player1UserID = userIDs[0]
+	newGame.Player2UserID = userIDs[1]
+	newGame.Player1Token = tokens[0]
+	newGame.Player2Token = tokens[1]
+	newGame.TimeControl = opts.TimeControl
+	newGame.Casual = opts.Casual
+	if opts.Start != nil {
+		newGame.SetPosition(opts.Start, opts.StartPlayer)
+	}
+	newGame.StartClock(now)
 
-	m.Hub.SetGame(gameID, newGame)
-	m.Hub.SetPlayerGame(player1.ID, gameID)
-	player1.GameID = gameID
+	difficulty := ""
+	if isBot {
+		if opts.Difficulty == "" {
+			opts.Difficulty = bot.DefaultDifficulty
+		}
+		difficulty = string(opts.Difficulty)
+		newGame.Difficulty = difficulty
+	}
 
-	if player2 != nil {
-		m.Hub.SetPlayerGame(player2.ID, gameID)
-		player2.GameID = gameID
+	var clock *game.TimeControl
+	if opts.TimeControl.Timed() {
+		clock = &opts.TimeControl
 	}
 
-	m.Hub.SendToClient(player1.ID, &ws.Message{
-		Type:     "game_start",
-		GameID:   gameID,
-		Opponent: p2Name,
-		YourTurn: true,
-		IsBot:    isBot,
-		Player:   game.Player1,
-	})
+	var board game.Board
+	if opts.Start != nil {
+		board = newGame.BoardSnapshot()
+	}
 
-	if player2 != nil {
-		m.Hub.SendToClient(player2.ID, &ws.Message{
-			Type:     "game_start",
-			GameID:   gameID,
-			Opponent: player1.Username,
-			YourTurn: false,
-			IsBot:    false,
-			Player:   game.Player2,
+	m.Hub.SetGame(gameID, newGame)
+
+	for i, client := range seats {
+		if client == nil {
+			continue
+		}
+
+		m.Hub.SetPlayerGame(client.ID, gameID)
+		m.Hub.SetPlayerGame(names[i], gameID)
+		client.SetGameID(gameID)
+
+		player := i + 1
+		m.Hub.SendToClient(client.ID, &ws.Message{
+			Type:           "game_start",
+			GameID:         gameID,
+			Opponent:       names[1-i],
+			ReconnectToken: tokens[i],
+			YourTurn:       player == newGame.CurrentPlayer,
+			IsBot:          isBot,
+			Difficulty:     difficulty,
+			Player:         player,
+			Rules:          &opts.Rules,
+			Clock:          clock,
+			TimeLeft:       newGame.ClockSnapshot(now),
+			Casual:         opts.Casual,
+			Board:          board,
+			Position:       newGame.Start,
 		})
 	}
 
-	log.Printf("Game started: %s vs %s (bot: %v)", player1.Username, p2Name, isBot)
+	log.Printf("Game started: %s vs %s (bot: %v)", names[0], names[1], isBot)
 
 	if m.OnGameStart != nil {
-		m.OnGameStart(newGame, player1, player2)
+		m.OnGameStart(newGame, seats[0], seats[1])
+	}
+}
+
+func (m *MatchMaker) abortStart(seats [2]*ws.Client) {
+	for _, client := range seats {
+		if client != nil {
+			m.Hub.SendToClient(client.ID, &ws.Message{
+				Type:    "error",
+				Message: "Could not start the game, please try again",
+			})
+		}
 	}
 }
 
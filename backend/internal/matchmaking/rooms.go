@@ -0,0 +1,170 @@
+package matchmaking
+
+import (
+	"crypto/rand"
+	"errors"
+	"four-in-a-row/internal/game"
+	ws "four-in-a-row/internal/websocket"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	RoomCodeLength = 6
+	RoomTimeout    = 15 * time.Minute
+)
+
+// roomAlphabet leaves out characters that are easy to misread when a code is
+// shared by voice or handwriting.
+const roomAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var (
+	ErrRoomNotFound = errors.New("Room not found")
+	ErrOwnRoom      = errors.New("You cannot join your own room")
+)
+
+type Room struct {
+	Code      string
+	Host      *ws.Client
+	Options   Options
+	CreatedAt time.Time
+	Timer     *time.Timer
+}
+
+type RoomStatus struct {
+	Code      string     `json:"code"`
+	Status    string     `json:"status"`
+	Host      string     `json:"host"`
+	Rules     game.Rules `json:"rules"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+// CreateRoom opens a private room hosted by client. The host waits in the room
+// until someone joins with the code; unlike the public queue there is no bot
+// fallback, only an expiry after RoomTimeout.
+func (m *MatchMaker) CreateRoom(client *ws.Client, opts Options) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeFromQueue(client.ID)
+	m.closeRooms(client.ID)
+
+	code, err := m.newRoomCode()
+	if err != nil {
+		return "", err
+	}
+
+	room := &Room{
+		Code:      code,
+		Host:      client,
+		Options:   opts,
+		CreatedAt: time.Now(),
+	}
+	room.Timer = time.AfterFunc(RoomTimeout, func() {
+		m.expireRoom(room)
+	})
+	m.Rooms[code] = room
+
+	m.Hub.SendToClient(client.ID, &ws.Message{
+		Type:     "room_created",
+		RoomCode: code,
+		Rules:    &opts.Rules,
+		Message:  "Share the room code with a friend to start the game",
+	})
+
+	log.Printf("Player %s created room %s", client.GetUsername(), code)
+	return code, nil
+}
+
+// JoinRoom starts the game in the room with the given code, with the host
+// moving first.
+func (m *MatchMaker) JoinRoom(client *ws.Client, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room := m.Rooms[strings.ToUpper(code)]
+	if room == nil {
+		return ErrRoomNotFound
+	}
+	if room.Host.ID == client.ID || room.Host.GetUsername() == client.GetUsername() {
+		return ErrOwnRoom
+	}
+
+	room.Timer.Stop()
+	delete(m.Rooms, room.Code)
+	m.removeFromQueue(client.ID)
+	m.closeRooms(client.ID)
+
+	log.Printf("Player %s joined room %s", client.GetUsername(), room.Code)
+	go m.startGame(room.Host, client, false, room.Options)
+	return nil
+}
+
+func (m *MatchMaker) GetRoom(code string) (RoomStatus, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	room := m.Rooms[strings.ToUpper(code)]
+	if room == nil {
+		return RoomStatus{}, false
+	}
+
+	return RoomStatus{
+		Code:      room.Code,
+		Status:    "waiting",
+		Host:      room.Host.GetUsername(),
+		Rules:     room.Options.Rules,
+		CreatedAt: room.CreatedAt,
+		ExpiresAt: room.CreatedAt.Add(RoomTimeout),
+	}, true
+}
+
+func (m *MatchMaker) expireRoom(room *Room) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Rooms[room.Code] != room {
+		return
+	}
+	delete(m.Rooms, room.Code)
+
+	m.Hub.SendToClient(room.Host.ID, &ws.Message{
+		Type:     "room_expired",
+		RoomCode: room.Code,
+		Message:  "Nobody joined the room in time",
+	})
+
+	log.Printf("Room %s expired", room.Code)
+}
+
+// closeRooms must be called with m.mu held.
+func (m *MatchMaker) closeRooms(clientID string) {
+	for code, room := range m.Rooms {
+		if room.Host.ID == clientID {
+			room.Timer.Stop()
+			delete(m.Rooms, code)
+			log.Printf("Room %s closed", code)
+		}
+	}
+}
+
+// newRoomCode must be called with m.mu held.
+func (m *MatchMaker) newRoomCode() (string, error) {
+	buf := make([]byte, RoomCodeLength)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+
+		code := make([]byte, RoomCodeLength)
+		for i, b := range buf {
+			code[i] = roomAlphabet[int(b)%len(roomAlphabet)]
+		}
+
+		if m.Rooms[string(code)] == nil {
+			return string(code), nil
+		}
+	}
+}
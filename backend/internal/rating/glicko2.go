@@ -0,0 +1,129 @@
+package rating
+
+import "math"
+
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+
+	// Tau limits how quickly volatility can change between games.
+	Tau = 0.5
+
+	scale     = 173.7178
+	tolerance = 0.000001
+)
+
+// Rating is a Glicko-2 rating on the familiar Elo-like scale.
+type Rating struct {
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"rating_deviation"`
+	Volatility float64 `json:"volatility"`
+}
+
+// Result is one game against Opponent. Score is 1 for a win, 0.5 for a draw
+// and 0 for a loss.
+type Result struct {
+	Opponent Rating
+	Score    float64
+}
+
+const (
+	Win  = 1.0
+	Draw = 0.5
+	Loss = 0.0
+)
+
+func Default() Rating {
+	return Rating{
+		Rating:     DefaultRating,
+		Deviation:  DefaultDeviation,
+		Volatility: DefaultVolatility,
+	}
+}
+
+// Update returns the rating after a rating period containing results. With no
+// results only the deviation grows.
+func (r Rating) Update(results ...Result) Rating {
+	mu := (r.Rating - DefaultRating) / scale
+	phi := r.Deviation / scale
+
+	if len(results) == 0 {
+		phi = math.Sqrt(phi*phi + r.Volatility*r.Volatility)
+		return Rating{
+			Rating:     r.Rating,
+			Deviation:  math.Min(phi*scale, DefaultDeviation),
+			Volatility: r.Volatility,
+		}
+	}
+
+	variance := 0.0
+	improvement := 0.0
+	for _, result := range results {
+		muJ := (result.Opponent.Rating - DefaultRating) / scale
+		gJ := g(result.Opponent.Deviation / scale)
+		e := expected(mu, muJ, gJ)
+
+		variance += gJ * gJ * e * (1 - e)
+		improvement += gJ * (result.Score - e)
+	}
+	variance = 1 / variance
+	delta := variance * improvement
+
+	sigma := volatility(phi, r.Volatility, variance, delta)
+
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/variance)
+	mu += phi * phi * improvement
+
+	return Rating{
+		Rating:     mu*scale + DefaultRating,
+		Deviation:  math.Min(phi*scale, DefaultDeviation),
+		Volatility: sigma,
+	}
+}
+
+func g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+func expected(mu, muJ, gJ float64) float64 {
+	return 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+}
+
+// volatility solves for the new volatility with the Illinois algorithm, as
+// in step 5 of Glickman's description of Glicko-2.
+func volatility(phi, sigma, variance, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + variance + ex
+		return ex*(delta*delta-phi*phi-variance-ex)/(2*d*d) - (x-a)/(Tau*Tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+variance {
+		B = math.Log(delta*delta - phi*phi - variance)
+	} else {
+		k := 1.0
+		for f(a-k*Tau) < 0 {
+			k++
+		}
+		B = a - k*Tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > tolerance {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
@@ -0,0 +1,60 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+// TestUpdateMatchesGlickmanExample checks the worked example in Glickman's
+// description of Glicko-2.
+func TestUpdateMatchesGlickmanExample(t *testing.T) {
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	got := player.Update(
+		Result{Opponent: Rating{Rating: 1400, Deviation: 30, Volatility: 0.06}, Score: Win},
+		Result{Opponent: Rating{Rating: 1550, Deviation: 100, Volatility: 0.06}, Score: Loss},
+		Result{Opponent: Rating{Rating: 1700, Deviation: 300, Volatility: 0.06}, Score: Loss},
+	)
+
+	if math.Abs(got.Rating-1464.06) > 0.01 {
+		t.Errorf("rating = %.2f, want 1464.06", got.Rating)
+	}
+	if math.Abs(got.Deviation-151.52) > 0.01 {
+		t.Errorf("deviation = %.2f, want 151.52", got.Deviation)
+	}
+	if math.Abs(got.Volatility-0.05999) > 0.00001 {
+		t.Errorf("volatility = %.5f, want 0.05999", got.Volatility)
+	}
+}
+
+func TestUpdateWithoutResults(t *testing.T) {
+	player := Rating{Rating: 1600, Deviation: 50, Volatility: 0.06}
+	got := player.Update()
+
+	if got.Rating != player.Rating || got.Volatility != player.Volatility {
+		t.Errorf("Update() = %+v, want only the deviation to change", got)
+	}
+	if got.Deviation <= player.Deviation {
+		t.Errorf("deviation = %.2f, want it to grow from %.2f", got.Deviation, player.Deviation)
+	}
+	if d := Default().Update().Deviation; d != DefaultDeviation {
+		t.Errorf("deviation of a new player = %.2f, want it capped at %.0f", d, DefaultDeviation)
+	}
+}
+
+func TestUpdateIsSymmetric(t *testing.T) {
+	a, b := Default(), Default()
+
+	winner := a.Update(Result{Opponent: b, Score: Win})
+	loser := b.Update(Result{Opponent: a, Score: Loss})
+	if winner.Rating <= a.Rating || loser.Rating >= b.Rating {
+		t.Fatalf("winner %.2f, loser %.2f", winner.Rating, loser.Rating)
+	}
+	if math.Abs((winner.Rating-a.Rating)+(loser.Rating-b.Rating)) > 1e-9 {
+		t.Errorf("winner gained %.4f but loser lost %.4f", winner.Rating-a.Rating, b.Rating-loser.Rating)
+	}
+
+	drawn := a.Update(Result{Opponent: b, Score: Draw})
+	if math.Abs(drawn.Rating-a.Rating) > 1e-9 {
+		t.Errorf("draw between equal players moved the rating to %.4f", drawn.Rating)
+	}
+}
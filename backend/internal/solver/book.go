@@ -0,0 +1,92 @@
+package solver
+
+import (
+	"bufio"
+	"fmt"
+	"four-in-a-row/internal/game"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// An opening book is a text file whose first line holds the board geometry
+// ("rows columns connect_n") followed by one "moves score" line per position,
+// where moves are 1-based column digits and score is the exact solver score
+// for the side to move.
+
+// LoadBook replaces the solver's opening book with the one in the file at
+// path. It must not be called while the solver is searching.
+func (s *Solver) LoadBook(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	book, err := ReadBook(file, s.Rules)
+	if err != nil {
+		return err
+	}
+
+	s.book = book
+	return nil
+}
+
+func (s *Solver) BookSize() int {
+	return len(s.book)
+}
+
+func ReadBook(r io.Reader, rules game.Rules) (map[uint64]int, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("opening book is empty")
+	}
+
+	var header game.Rules
+	if _, err := fmt.Sscanf(scanner.Text(), "%d %d %d", &header.Rows, &header.Columns, &header.ConnectN); err != nil {
+		return nil, fmt.Errorf("invalid opening book header: %v", err)
+	}
+	if header != rules {
+		return nil, fmt.Errorf("opening book is for a %dx%d connect %d board", header.Columns, header.Rows, header.ConnectN)
+	}
+
+	book := make(map[uint64]int)
+	for line := 2; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("opening book line %d: expected moves and score", line)
+		}
+
+		pos := game.NewPosition(rules)
+		for _, digit := range fields[0] {
+			column := int(digit - '1')
+			if !pos.CanPlay(column) {
+				return nil, fmt.Errorf("opening book line %d: invalid move %q", line, digit)
+			}
+			pos.Play(column)
+		}
+
+		score, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("opening book line %d: %v", line, err)
+		}
+		book[pos.Hash()] = score
+	}
+
+	return book, scanner.Err()
+}
+
+func WriteBookHeader(w io.Writer, rules game.Rules) error {
+	_, err := fmt.Fprintf(w, "%d %d %d\n", rules.Rows, rules.Columns, rules.ConnectN)
+	return err
+}
+
+func WriteBookEntry(w io.Writer, moves []int, score int) error {
+	var b strings.Builder
+	for _, column := range moves {
+		b.WriteByte(byte('1' + column))
+	}
+	_, err := fmt.Fprintf(w, "%s %d\n", b.String(), score)
+	return err
+}
@@ -0,0 +1,307 @@
+package solver
+
+import (
+	"errors"
+	"four-in-a-row/internal/game"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	TableBits  = 20
+	checkEvery = 4096
+)
+
+var ErrTimeout = errors.New("solver: time limit reached")
+
+type Outcome string
+
+const (
+	Win  Outcome = "win"
+	Loss Outcome = "loss"
+	Draw Outcome = "draw"
+)
+
+// ColumnResult is the exact value of playing Column, from the point of view
+// of the player making that move. Plies counts moves from the analysed
+// position until the game ends under perfect play, including this one.
+type ColumnResult struct {
+	Column  int     `json:"column"`
+	Score   int     `json:"score"`
+	Outcome Outcome `json:"outcome"`
+	Plies   int     `json:"plies"`
+}
+
+// Solver scores positions exactly. Scores follow the usual convention:
+// positive when the side to move wins, larger the sooner it wins, and zero
+// for a draw.
+//
+// A Solver is safe for concurrent use: the opening book is shared read-only
+// and every search takes its own transposition table from a pool, so games
+// searching at the same time do not wait for each other.
+type Solver struct {
+	Rules    game.Rules
+	book     map[uint64]int
+	order    []int
+	searches sync.Pool
+}
+
+// search is the state of one solver search.
+type search struct {
+	*Solver
+	table    *table
+	deadline time.Time
+	nodes    int
+	stopped  bool
+}
+
+func New(rules game.Rules) *Solver {
+	order := make([]int, 0, rules.Columns)
+	center := rules.Columns / 2
+	order = append(order, center)
+	for offset := 1; len(order) < rules.Columns; offset++ {
+		if center-offset >= 0 {
+			order = append(order, center-offset)
+		}
+		if center+offset < rules.Columns {
+			order = append(order, center+offset)
+		}
+	}
+
+	s := &Solver{
+		Rules: rules,
+		book:  make(map[uint64]int),
+		order: order,
+	}
+	s.searches.New = func() interface{} {
+		return &search{Solver: s, table: newTable(TableBits)}
+	}
+	return s
+}
+
+// start takes a search from the pool for a search of at most timeout. It
+// must be handed back with finish.
+func (s *Solver) start(timeout time.Duration) *search {
+	search := s.searches.Get().(*search)
+	search.nodes = 0
+	search.stopped = false
+	search.deadline = time.Now().Add(timeout)
+	return search
+}
+
+func (s *Solver) finish(search *search) {
+	s.searches.Put(search)
+}
+
+func (s *Solver) Solve(pos *game.Position, timeout time.Duration) (int, error) {
+	search := s.start(timeout)
+	defer s.finish(search)
+
+	score := search.solve(pos)
+	if search.stopped {
+		return 0, ErrTimeout
+	}
+	return score, nil
+}
+
+func (s *Solver) Analyze(pos *game.Position, timeout time.Duration) ([]ColumnResult, error) {
+	search := s.start(timeout)
+	defer s.finish(search)
+
+	cells := s.Rules.Rows * s.Rules.Columns
+	results := make([]ColumnResult, 0, s.Rules.Columns)
+
+	for c := 0; c < s.Rules.Columns; c++ {
+		if !pos.CanPlay(c) {
+			continue
+		}
+
+		var score int
+		if pos.IsWinningMove(c) {
+			score = (cells + 1 - pos.Moves()) / 2
+		} else {
+			pos.Play(c)
+			score = -search.solve(pos)
+			pos.Undo(c)
+		}
+
+		if search.stopped {
+			return nil, ErrTimeout
+		}
+
+		results = append(results, s.result(pos, c, score))
+	}
+
+	return results, nil
+}
+
+func (s *Solver) BestMove(pos *game.Position, timeout time.Duration) (int, error) {
+	results, err := s.Analyze(pos, timeout)
+	if err != nil {
+		return -1, err
+	}
+
+	best := -1
+	bestScore := 0
+	center := s.Rules.Columns / 2
+	for _, r := range results {
+		closer := best != -1 && r.Score == bestScore && abs(r.Column-center) < abs(best-center)
+		if best == -1 || r.Score > bestScore || closer {
+			best = r.Column
+			bestScore = r.Score
+		}
+	}
+	return best, nil
+}
+
+func (s *Solver) result(pos *game.Position, column, score int) ColumnResult {
+	cells := s.Rules.Rows * s.Rules.Columns
+	moves := pos.Moves()
+
+	r := ColumnResult{Column: column, Score: score, Outcome: Draw, Plies: cells - moves}
+	switch {
+	case score > 0:
+		r.Outcome = Win
+		r.Plies = lastMove(cells+1-2*score, moves) - moves + 1
+	case score < 0:
+		r.Outcome = Loss
+		r.Plies = lastMove(cells+1+2*score, moves+1) - moves + 1
+	}
+	return r
+}
+
+// lastMove returns the number of stones on the board just before the winning
+// stone is dropped, given the score formula's estimate and the parity of the
+// winner's turns.
+func lastMove(estimate, winnerMoves int) int {
+	if (estimate-winnerMoves)%2 != 0 {
+		estimate--
+	}
+	return estimate
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func (s *search) solve(pos *game.Position) int {
+	cells := s.Rules.Rows * s.Rules.Columns
+	if pos.WinningCells()&pos.PlayableCells() != 0 {
+		return (cells + 1 - pos.Moves()) / 2
+	}
+
+	min := -(cells - pos.Moves()) / 2
+	max := (cells + 1 - pos.Moves()) / 2
+
+	for min < max && !s.stopped {
+		med := min + (max-min)/2
+		if med <= 0 && min/2 < med {
+			med = min / 2
+		} else if med >= 0 && max/2 > med {
+			med = max / 2
+		}
+
+		r := s.negamax(pos, med, med+1)
+		if r <= med {
+			max = r
+		} else {
+			min = r
+		}
+	}
+
+	return min
+}
+
+func (s *search) negamax(pos *game.Position, alpha, beta int) int {
+	s.nodes++
+	if s.nodes%checkEvery == 0 && time.Now().After(s.deadline) {
+		s.stopped = true
+	}
+	if s.stopped {
+		return alpha
+	}
+
+	cells := s.Rules.Rows * s.Rules.Columns
+	moves := pos.Moves()
+
+	next := pos.NonLosingMoves()
+	if next == 0 {
+		return -(cells - moves) / 2
+	}
+
+	if moves >= cells-2 {
+		return 0
+	}
+
+	if score, ok := s.book[pos.Hash()]; ok {
+		return score
+	}
+
+	min := -(cells - 2 - moves) / 2
+	if alpha < min {
+		alpha = min
+		if alpha >= beta {
+			return alpha
+		}
+	}
+
+	max := (cells - 1 - moves) / 2
+	if bound, ok := s.table.get(pos.Hash()); ok {
+		max = bound
+	}
+	if beta > max {
+		beta = max
+		if alpha >= beta {
+			return beta
+		}
+	}
+
+	var candidates [game.MaxSize]int
+	var threats [game.MaxSize]int
+	count := 0
+
+	for _, c := range s.order {
+		if next&pos.ColumnMask(c) == 0 {
+			continue
+		}
+
+		pos.Play(c)
+		threat := bits.OnesCount64(pos.OpponentWinningCells())
+		pos.Undo(c)
+
+		i := count
+		for i > 0 && threats[i-1] < threat {
+			candidates[i] = candidates[i-1]
+			threats[i] = threats[i-1]
+			i--
+		}
+		candidates[i] = c
+		threats[i] = threat
+		count++
+	}
+
+	for i := 0; i < count; i++ {
+		c := candidates[i]
+
+		pos.Play(c)
+		score := -s.negamax(pos, -beta, -alpha)
+		pos.Undo(c)
+
+		if s.stopped {
+			return alpha
+		}
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	s.table.put(pos.Hash(), alpha)
+	return alpha
+}
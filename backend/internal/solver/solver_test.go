@@ -0,0 +1,196 @@
+package solver
+
+import (
+	"four-in-a-row/internal/game"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// bruteForce scores pos by searching every line to the end, remembering the
+// positions it has already scored in memo.
+func bruteForce(pos *game.Position, memo map[uint64]int) int {
+	if score, ok := memo[pos.Hash()]; ok {
+		return score
+	}
+
+	rules := pos.Rules()
+	cells := rules.Rows * rules.Columns
+	if pos.IsFull() {
+		return 0
+	}
+	for c := 0; c < rules.Columns; c++ {
+		if pos.CanPlay(c) && pos.IsWinningMove(c) {
+			return (cells + 1 - pos.Moves()) / 2
+		}
+	}
+
+	best := -cells
+	for c := 0; c < rules.Columns; c++ {
+		if !pos.CanPlay(c) {
+			continue
+		}
+		pos.Play(c)
+		if score := -bruteForce(pos, memo); score > best {
+			best = score
+		}
+		pos.Undo(c)
+	}
+
+	memo[pos.Hash()] = best
+	return best
+}
+
+// randomPosition plays up to plies random moves that do not end the game.
+func randomPosition(rng *rand.Rand, rules game.Rules, plies int) *game.Position {
+	pos := game.NewPosition(rules)
+	for pos.Moves() < plies {
+		var moves []int
+		for c := 0; c < rules.Columns; c++ {
+			if pos.CanPlay(c) && !pos.IsWinningMove(c) {
+				moves = append(moves, c)
+			}
+		}
+		if len(moves) == 0 {
+			break
+		}
+		pos.Play(moves[rng.Intn(len(moves))])
+	}
+	return pos
+}
+
+func TestSolveMatchesBruteForce(t *testing.T) {
+	tests := []struct {
+		rules game.Rules
+		plies int
+	}{
+		{game.Rules{Rows: 4, Columns: 4, ConnectN: 3}, 0},
+		{game.Rules{Rows: 4, Columns: 4, ConnectN: 3}, 4},
+		{game.Rules{Rows: 4, Columns: 5, ConnectN: 3}, 6},
+		{game.Variants["5x4"], 6},
+		{game.Variants["5x4"], 10},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		memo := make(map[uint64]int)
+		s := New(tt.rules)
+
+		for i := 0; i < 20; i++ {
+			pos := randomPosition(rng, tt.rules, tt.plies)
+			want := bruteForce(pos.Clone(), memo)
+
+			got, err := s.Solve(pos, time.Minute)
+			if err != nil {
+				t.Fatalf("%+v after %d plies: %v", tt.rules, pos.Moves(), err)
+			}
+			if got != want {
+				t.Errorf("%+v after %d plies: Solve = %d, brute force = %d", tt.rules, pos.Moves(), got, want)
+			}
+		}
+	}
+}
+
+func TestAnalyzeMatchesBruteForce(t *testing.T) {
+	rules := game.Variants["5x4"]
+	memo := make(map[uint64]int)
+	s := New(rules)
+	rng := rand.New(rand.NewSource(2))
+
+	for i := 0; i < 20; i++ {
+		pos := randomPosition(rng, rules, 8)
+		results, err := s.Analyze(pos, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range results {
+			var want int
+			if pos.IsWinningMove(r.Column) {
+				want = (rules.Rows*rules.Columns + 1 - pos.Moves()) / 2
+			} else {
+				pos.Play(r.Column)
+				want = -bruteForce(pos.Clone(), memo)
+				pos.Undo(r.Column)
+			}
+
+			if r.Score != want {
+				t.Errorf("column %d: score %d, brute force %d", r.Column, r.Score, want)
+			}
+			if (r.Score > 0) != (r.Outcome == Win) || (r.Score < 0) != (r.Outcome == Loss) {
+				t.Errorf("column %d: outcome %s for score %d", r.Column, r.Outcome, r.Score)
+			}
+		}
+	}
+}
+
+func TestSolveTimesOut(t *testing.T) {
+	s := New(game.DefaultRules)
+	if _, err := s.Solve(game.NewPosition(game.DefaultRules), time.Millisecond); err != ErrTimeout {
+		t.Errorf("Solve of the empty classic board in 1ms: err = %v, want ErrTimeout", err)
+	}
+}
+
+func TestReadBook(t *testing.T) {
+	rules := game.Variants["5x4"]
+	book, err := ReadBook(strings.NewReader("4 5 4\n33 0\n31 -2\n"), rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book) != 2 {
+		t.Errorf("read %d positions, want 2", len(book))
+	}
+
+	pos := game.NewPosition(rules)
+	pos.Play(2)
+	pos.Play(0)
+	if score, ok := book[pos.Hash()]; !ok || score != -2 {
+		t.Errorf("book score of 31 = %d, %v; want -2", score, ok)
+	}
+
+	if _, err := ReadBook(strings.NewReader("6 7 4\n"), rules); err == nil {
+		t.Error("ReadBook accepted a book for another board")
+	}
+	if _, err := ReadBook(strings.NewReader("4 5 4\n99999 0\n"), rules); err == nil {
+		t.Error("ReadBook accepted an unplayable line")
+	}
+}
+
+func TestSolveConcurrently(t *testing.T) {
+	rules := game.Variants["5x4"]
+	s := New(rules)
+	rng := rand.New(rand.NewSource(3))
+
+	positions := make([]*game.Position, 16)
+	want := make([]int, len(positions))
+	memo := make(map[uint64]int)
+	for i := range positions {
+		positions[i] = randomPosition(rng, rules, 8)
+		want[i] = bruteForce(positions[i].Clone(), memo)
+	}
+
+	var wg sync.WaitGroup
+	for i := range positions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, err := s.Solve(positions[i], time.Minute)
+			if err != nil || got != want[i] {
+				t.Errorf("position %d: Solve = %d, %v; want %d", i, got, err, want[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCommittedBookLoads(t *testing.T) {
+	s := New(game.DefaultRules)
+	if err := s.LoadBook("../../books/book-7x6.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if s.BookSize() == 0 {
+		t.Error("the committed opening book is empty")
+	}
+}
@@ -0,0 +1,32 @@
+package solver
+
+type tableEntry struct {
+	key   uint64
+	bound int8
+	valid bool
+}
+
+type table struct {
+	entries []tableEntry
+	mask    uint64
+}
+
+func newTable(bits uint) *table {
+	size := uint64(1) << bits
+	return &table{
+		entries: make([]tableEntry, size),
+		mask:    size - 1,
+	}
+}
+
+func (t *table) get(key uint64) (int, bool) {
+	entry := t.entries[key&t.mask]
+	if !entry.valid || entry.key != key {
+		return 0, false
+	}
+	return int(entry.bound), true
+}
+
+func (t *table) put(key uint64, bound int) {
+	t.entries[key&t.mask] = tableEntry{key: key, bound: int8(bound), valid: true}
+}
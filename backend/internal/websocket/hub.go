@@ -11,13 +11,17 @@ import (
 )
 
 type Client struct {
-	ID       string
-	Username string
-	Conn     *websocket.Conn
-	Hub      *Hub
-	GameID   string
-	Send     chan []byte
-	mu       sync.Mutex
+	ID         string
+	Conn       *websocket.Conn
+	Hub        *Hub
+	Send       chan []byte
+	username   string
+	userID     string
+	gameID     string
+	spectating string
+	lobby      bool
+	stateMu    sync.RWMutex
+	mu         sync.Mutex
 }
 
 type Hub struct {
@@ -28,24 +32,52 @@ type Hub struct {
 	Register         chan *Client
 	Unregister       chan *Client
 	Broadcast        chan *Message
+	OnDisconnect     func(client *Client)
 	mu               sync.RWMutex
 }
 
 type Message struct {
-	Type     string          `json:"type"`
-	GameID   string          `json:"game_id,omitempty"`
-	Username string          `json:"username,omitempty"`
-	Column   int             `json:"column,omitempty"`
-	Row      int             `json:"row,omitempty"`
-	Player   int             `json:"player,omitempty"`
-	Board    *game.Board     `json:"board,omitempty"`
-	Winner   string          `json:"winner,omitempty"`
-	Reason   string          `json:"reason,omitempty"`
-	Opponent string          `json:"opponent,omitempty"`
-	YourTurn bool            `json:"your_turn,omitempty"`
-	Message  string          `json:"message,omitempty"`
-	IsBot    bool            `json:"is_bot,omitempty"`
-	Data     json.RawMessage `json:"data,omitempty"`
+	Type           string            `json:"type"`
+	GameID         string            `json:"game_id,omitempty"`
+	Username       string            `json:"username,omitempty"`
+	Column         int               `json:"column,omitempty"`
+	Row            int               `json:"row,omitempty"`
+	Player         int               `json:"player,omitempty"`
+	Board          game.Board        `json:"board,omitempty"`
+	Rules          *game.Rules       `json:"rules,omitempty"`
+	Variant        string            `json:"variant,omitempty"`
+	Difficulty     string            `json:"difficulty,omitempty"`
+	FirstPlayer    string            `json:"first_player,omitempty"`
+	RoomCode       string            `json:"room_code,omitempty"`
+	Players        []string          `json:"players,omitempty"`
+	Moves          []game.Move       `json:"moves,omitempty"`
+	Spectators     int               `json:"spectators,omitempty"`
+	Games          []LiveGame        `json:"games,omitempty"`
+	Game           *LiveGame         `json:"game,omitempty"`
+	QueuePosition  int               `json:"queue_position,omitempty"`
+	EstimatedWait  int               `json:"estimated_wait,omitempty"`
+	TimeControl    string            `json:"time_control,omitempty"`
+	Clock          *game.TimeControl `json:"clock,omitempty"`
+	TimeLeft       []int64           `json:"time_left,omitempty"`
+	Hint           *Hint             `json:"hint,omitempty"`
+	Casual         bool              `json:"casual,omitempty"`
+	Position       string            `json:"position,omitempty"`
+	Winner         string            `json:"winner,omitempty"`
+	Reason         string            `json:"reason,omitempty"`
+	Opponent       string            `json:"opponent,omitempty"`
+	ReconnectToken string            `json:"reconnect_token,omitempty"`
+	YourTurn       bool              `json:"your_turn,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	IsBot          bool              `json:"is_bot,omitempty"`
+	Data           json.RawMessage   `json:"data,omitempty"`
+}
+
+// Hint is a suggested move. Its fields are always sent, since column 0 and a
+// score of 0 are both meaningful.
+type Hint struct {
+	Column int `json:"column"`
+	Score  int `json:"score"`
+	Hints  int `json:"hints"`
 }
 
 func NewHub() *Hub {
@@ -67,7 +99,7 @@ func (h *Hub) Run() {
 			h.mu.Lock()
 			h.Clients[client.ID] = client
 			h.mu.Unlock()
-			log.Printf("Client registered: %s (%s)", client.Username, client.ID)
+			log.Printf("Client registered: %s (%s)", client.GetUsername(), client.ID)
 
 		case client := <-h.Unregister:
 			h.mu.Lock()
@@ -76,7 +108,11 @@ func (h *Hub) Run() {
 				close(client.Send)
 			}
 			h.mu.Unlock()
-			log.Printf("Client unregistered: %s (%s)", client.Username, client.ID)
+			log.Printf("Client unregistered: %s (%s)", client.GetUsername(), client.ID)
+
+			if h.OnDisconnect != nil {
+				go h.OnDisconnect(client)
+			}
 
 		case message := <-h.Broadcast:
 			h.broadcastToGame(message)
@@ -85,11 +121,10 @@ func (h *Hub) Run() {
 }
 
 func (h *Hub) broadcastToGame(msg *Message) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
-	gameObj, exists := h.Games[msg.GameID]
-	if !exists {
+	if _, exists := h.Games[msg.GameID]; !exists {
 		return
 	}
 
@@ -100,7 +135,7 @@ func (h *Hub) broadcastToGame(msg *Message) {
 	}
 
 	for _, client := range h.Clients {
-		if client.GameID == msg.GameID {
+		if client.GetGameID() == msg.GameID || client.GetSpectating() == msg.GameID {
 			select {
 			case client.Send <- data:
 			default:
@@ -109,24 +144,23 @@ func (h *Hub) broadcastToGame(msg *Message) {
 			}
 		}
 	}
-	_ = gameObj
 }
 
 func (h *Hub) SendToClient(clientID string, msg *Message) {
-	h.mu.RLock()
-	client, exists := h.Clients[clientID]
-	h.mu.RUnlock()
-
-	if !exists {
-		return
-	}
-
 	data, err := json.Marshal(msg)
 	if err != nil {
 		log.Printf("Error marshaling message: %v", err)
 		return
 	}
 
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	client, exists := h.Clients[clientID]
+	if !exists {
+		return
+	}
+
 	select {
 	case client.Send <- data:
 	default:
@@ -174,13 +208,26 @@ func (h *Hub) GetClientByUsername(username string) *Client {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	for _, client := range h.Clients {
-		if client.Username == username {
+		if client.GetUsername() == username {
 			return client
 		}
 	}
 	return nil
 }
 
+func (h *Hub) CountSpectators(gameID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	count := 0
+	for _, client := range h.Clients {
+		if client.GetSpectating() == gameID {
+			count++
+		}
+	}
+	return count
+}
+
 func (h *Hub) StartDisconnectTimer(clientID string, duration time.Duration, onTimeout func()) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -202,6 +249,57 @@ func (h *Hub) CancelDisconnectTimer(clientID string) {
 	}
 }
 
+func (c *Client) GetUsername() string {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.username
+}
+
+func (c *Client) SetUsername(username string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.username = username
+}
+
+// GetUserID returns the account the client authenticated as, or "" for a
+// guest.
+func (c *Client) GetUserID() string {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.userID
+}
+
+func (c *Client) SetUser(userID, username string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.userID = userID
+	c.username = username
+}
+
+func (c *Client) GetGameID() string {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.gameID
+}
+
+func (c *Client) SetGameID(gameID string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.gameID = gameID
+}
+
+func (c *Client) GetSpectating() string {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.spectating
+}
+
+func (c *Client) SetSpectating(gameID string) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.spectating = gameID
+}
+
 func (c *Client) ReadPump(handleMessage func(*Client, []byte)) {
 	defer func() {
 		c.Hub.Unregister <- c
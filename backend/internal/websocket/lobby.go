@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"encoding/json"
+	"four-in-a-row/internal/game"
+	"log"
+	"sort"
+)
+
+type LiveGame struct {
+	GameID     string     `json:"game_id"`
+	Player1    string     `json:"player1"`
+	Player2    string     `json:"player2"`
+	Rules      game.Rules `json:"rules"`
+	Moves      int        `json:"moves"`
+	StartTime  int64      `json:"start_time"`
+	IsBot      bool       `json:"is_bot"`
+	Difficulty string     `json:"difficulty,omitempty"`
+	Spectators int        `json:"spectators"`
+}
+
+// NewLiveGame summarises g for the lobby. It must be called with g locked.
+func NewLiveGame(g *game.Game) LiveGame {
+	return LiveGame{
+		GameID:     g.ID,
+		Player1:    g.Player1Name,
+		Player2:    g.Player2Name,
+		Rules:      g.Rules,
+		Moves:      len(g.Line()),
+		StartTime:  g.StartTime,
+		IsBot:      g.IsBot,
+		Difficulty: g.Difficulty,
+	}
+}
+
+func (h *Hub) RemoveGame(gameID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.Games, gameID)
+}
+
+// LiveGames lists the games still in progress, newest first.
+func (h *Hub) LiveGames() []LiveGame {
+	h.mu.RLock()
+	games := make([]*game.Game, 0, len(h.Games))
+	for _, g := range h.Games {
+		games = append(games, g)
+	}
+	h.mu.RUnlock()
+
+	live := make([]LiveGame, 0, len(games))
+	for _, g := range games {
+		g.Lock()
+		if !g.IsOver {
+			live = append(live, NewLiveGame(g))
+		}
+		g.Unlock()
+	}
+
+	for i := range live {
+		live[i].Spectators = h.CountSpectators(live[i].GameID)
+	}
+
+	sort.Slice(live, func(i, j int) bool {
+		return live[i].StartTime > live[j].StartTime
+	})
+	return live
+}
+
+func (h *Hub) BroadcastLobby(msg *Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.Clients {
+		if !client.InLobby() {
+			continue
+		}
+		select {
+		case client.Send <- data:
+		default:
+			log.Printf("Failed to send lobby update to client %s", client.ID)
+		}
+	}
+}
+
+func (c *Client) InLobby() bool {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.lobby
+}
+
+func (c *Client) SetLobby(subscribed bool) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.lobby = subscribed
+}
@@ -27,10 +27,14 @@ type GameStartData struct {
 	IsBot   bool   `json:"is_bot"`
 }
 
+// MoveData times are in milliseconds: Timestamp is when the server accepted
+// the move and ThinkTime how long the player took over it.
 type MoveData struct {
-	Player int `json:"player"`
-	Column int `json:"column"`
-	Row    int `json:"row"`
+	Player    int   `json:"player"`
+	Column    int   `json:"column"`
+	Row       int   `json:"row"`
+	Timestamp int64 `json:"timestamp"`
+	ThinkTime int64 `json:"think_time"`
 }
 
 type GameEndData struct {
@@ -81,7 +85,7 @@ func (p *Producer) SendGameStart(gameID, player1, player2 string, isBot bool) {
 	p.send(event)
 }
 
-func (p *Producer) SendMove(gameID string, player, column, row int) {
+func (p *Producer) SendMove(gameID string, player, column, row int, timestamp, thinkTime int64) {
 	if !p.enabled {
 		return
 	}
@@ -91,9 +95,34 @@ func (p *Producer) SendMove(gameID string, player, column, row int) {
 		GameID:    gameID,
 		Timestamp: time.Now().Unix(),
 		Data: MoveData{
-			Player: player,
-			Column: column,
-			Row:    row,
+			Player:    player,
+			Column:    column,
+			Row:       row,
+			Timestamp: timestamp,
+			ThinkTime: thinkTime,
+		},
+	}
+
+	p.send(event)
+}
+
+// SendTakeback reports that a move was taken back. The data is the undone
+// move, so consumers can discount it from their move counts.
+func (p *Producer) SendTakeback(gameID string, player, column, row int, timestamp, thinkTime int64) {
+	if !p.enabled {
+		return
+	}
+
+	event := GameEvent{
+		Type:      "takeback",
+		GameID:    gameID,
+		Timestamp: time.Now().Unix(),
+		Data: MoveData{
+			Player:    player,
+			Column:    column,
+			Row:       row,
+			Timestamp: timestamp,
+			ThinkTime: thinkTime,
 		},
 	}
 
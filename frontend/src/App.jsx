@@ -36,7 +36,7 @@ function App() {
                         ...prev,
                         status: 'playing',
                         gameId: msg.game_id,
-                        board: Array(6).fill(null).map(() => Array(7).fill(0)),
+                        board: Array(msg.rules?.rows || 6).fill(null).map(() => Array(msg.rules?.columns || 7).fill(0)),
                         currentPlayer: msg.your_turn ? msg.player : (msg.player === 1 ? 2 : 1),
                         myPlayer: msg.player,
                         opponent: msg.opponent,
@@ -4,13 +4,13 @@ const GameBoard = memo(function GameBoard({ board, onColumnClick, disabled, curr
     return (
         <div className="board">
             <div className="board-grid">
-                {Array(7).fill(null).map((_, colIndex) => (
+                {board[0].map((_, colIndex) => (
                     <div
                         key={colIndex}
                         className={`column ${disabled ? 'disabled' : ''}`}
                         onClick={() => !disabled && onColumnClick(colIndex)}
                     >
-                        {Array(6).fill(null).map((_, rowIndex) => {
+                        {board.map((_, rowIndex) => {
                             const cellValue = board[rowIndex][colIndex];
                             return (
                                 <div